@@ -0,0 +1,72 @@
+package rkindex
+
+// refBudget tracks the total number of strings held by an index's hash
+// buckets while the index is built, so that the total can be kept within a
+// limit. It groups the buckets by size, which lets it find the largest
+// bucket in constant time whenever the limit is exceeded.
+type refBudget struct {
+	limit int            // maximum number of bucket references
+	total int            // current number of bucket references
+	sizes [][]uint32     // hashes of the buckets of each size
+	slot  map[uint32]int // position of each hash within its size's group
+	top   int            // size of the largest bucket
+}
+
+// newRefBudget creates a budget allowing up to limit bucket references.
+func newRefBudget(limit int) *refBudget {
+	return &refBudget{
+		limit: limit,
+		sizes: [][]uint32{nil},
+		slot:  make(map[uint32]int),
+	}
+}
+
+// grow records that a string was added to the hash's bucket, which now
+// holds size strings.
+func (b *refBudget) grow(hash uint32, size int) {
+	if size > 1 {
+		b.take(hash, size-1)
+	}
+	if size == len(b.sizes) {
+		b.sizes = append(b.sizes, nil)
+	}
+	b.slot[hash] = len(b.sizes[size])
+	b.sizes[size] = append(b.sizes[size], hash)
+	b.top = max(b.top, size)
+	b.total++
+}
+
+// remove records that the hash's bucket, which held size strings, was
+// discarded.
+func (b *refBudget) remove(hash uint32, size int) {
+	if _, ok := b.slot[hash]; !ok {
+		return
+	}
+	b.take(hash, size)
+	delete(b.slot, hash)
+	b.total -= size
+	for b.top > 0 && len(b.sizes[b.top]) == 0 {
+		b.top--
+	}
+}
+
+// take removes the hash from the group of buckets of the given size.
+func (b *refBudget) take(hash uint32, size int) {
+	group := b.sizes[size]
+	k, last := b.slot[hash], len(group)-1
+	group[k] = group[last]
+	b.slot[group[k]] = k
+	b.sizes[size] = group[:last]
+}
+
+// full returns true if adding another string to a bucket would exceed the
+// limit.
+func (b *refBudget) full() bool {
+	return b.total >= b.limit
+}
+
+// largest returns the hash of the largest bucket.
+func (b *refBudget) largest() uint32 {
+	group := b.sizes[b.top]
+	return group[len(group)-1]
+}
@@ -0,0 +1,36 @@
+package rkindex
+
+import "testing"
+
+func TestRefBudget(t *testing.T) {
+	b := newRefBudget(5)
+
+	// Buckets 1 and 2 grow to 2 strings each, bucket 3 to 1 string.
+	b.grow(1, 1)
+	b.grow(2, 1)
+	b.grow(1, 2)
+	b.grow(3, 1)
+	if b.full() || b.total != 4 || b.top != 2 || b.largest() != 1 {
+		t.Fatalf("Unexpected budget state %+v", b)
+	}
+
+	b.grow(2, 2)
+	if !b.full() || b.total != 5 || b.largest() != 2 {
+		t.Fatalf("Expected full budget with largest bucket 2, got %+v", b)
+	}
+
+	b.remove(2, 2)
+	if b.full() || b.total != 3 || b.top != 2 || b.largest() != 1 {
+		t.Fatalf("Unexpected budget state after removal %+v", b)
+	}
+	b.remove(1, 2)
+	if b.total != 1 || b.top != 1 || b.largest() != 3 {
+		t.Fatalf("Unexpected budget state after removal %+v", b)
+	}
+
+	// Removing an untracked hash changes nothing.
+	b.remove(42, 0)
+	if b.total != 1 || b.top != 1 {
+		t.Errorf("Expected untracked removal to be ignored, got %+v", b)
+	}
+}
@@ -0,0 +1,87 @@
+package rkindex
+
+import (
+	"container/list"
+	"slices"
+	"sync"
+)
+
+// cache is a bounded, least-recently-used cache of query results. Each entry
+// records the index generation it was computed at, and entries from older
+// generations are treated as misses.
+type cache struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[string]*list.Element
+	order    *list.List // most recently used at the front
+}
+
+// cacheEntry is a single cached query result.
+type cacheEntry struct {
+	query      string
+	generation uint64
+	result     []string
+}
+
+// newCache creates a query cache holding up to capacity results.
+func newCache(capacity int) *cache {
+	return &cache{
+		capacity: capacity,
+		entries:  make(map[string]*list.Element, capacity),
+		order:    list.New(),
+	}
+}
+
+// get returns a copy of the cached result for a query, if the cache holds
+// one computed at the given generation.
+func (c *cache) get(query string, generation uint64) ([]string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[query]
+	if !ok {
+		return nil, false
+	}
+	entry := e.Value.(*cacheEntry)
+	if entry.generation != generation {
+		c.order.Remove(e)
+		delete(c.entries, query)
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	return slices.Clone(entry.result), true
+}
+
+// put stores a copy of a query's result computed at the given generation,
+// evicting the least recently used result if the cache is full.
+func (c *cache) put(query string, generation uint64, result []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[query]; ok {
+		entry := e.Value.(*cacheEntry)
+		entry.generation = generation
+		entry.result = slices.Clone(result)
+		c.order.MoveToFront(e)
+		return
+	}
+
+	if c.order.Len() >= c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).query)
+	}
+	entry := &cacheEntry{
+		query:      query,
+		generation: generation,
+		result:     slices.Clone(result),
+	}
+	c.entries[query] = c.order.PushFront(entry)
+}
+
+// len returns the number of results held by the cache.
+func (c *cache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
@@ -0,0 +1,75 @@
+package rkindex
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestCachedIndex(t *testing.T) {
+	idx := NewCachedIndex([]string{"hello world", "world of code", "hello code"}, 2)
+
+	first := idx.Find("world")
+	sort.Strings(first)
+	if idx.cache.len() != 1 {
+		t.Fatalf("Expected 1 cached result, got %d", idx.cache.len())
+	}
+
+	// A cache hit should return the same results.
+	second := idx.Find("world")
+	sort.Strings(second)
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("Expected cached result %v, got %v", first, second)
+	}
+
+	// Mutating a returned result should not corrupt the cache.
+	second[0] = "corrupted"
+	third := idx.Find("world")
+	sort.Strings(third)
+	if !reflect.DeepEqual(first, third) {
+		t.Errorf("Expected cached result %v, got %v", first, third)
+	}
+
+	// The least recently used result should be evicted when full.
+	idx.Find("hello")
+	idx.Find("code")
+	if idx.cache.len() != 2 {
+		t.Errorf("Expected 2 cached results, got %d", idx.cache.len())
+	}
+	if _, ok := idx.cache.get("world", idx.generation); ok {
+		t.Error("Expected least recently used result to be evicted")
+	}
+}
+
+func TestCachedIndexInvalidation(t *testing.T) {
+	idx := NewCachedIndex([]string{"hello world", "world of code", "hello code"}, 10)
+	if got := idx.Find("world"); len(got) != 2 {
+		t.Fatalf("Expected 2 matches, got %v", got)
+	}
+
+	// Change the index's contents and advance its generation, as any
+	// mutation of the index must.
+	added := "brave new world"
+	idx.strings = append(idx.strings, added)
+	for s := added; len(s) >= n; s = s[1:] {
+		appendHashUnique(idx, hash(s[:n]), added)
+	}
+	idx.generation++
+
+	result := idx.Find("world")
+	sort.Strings(result)
+	expected := []string{"brave new world", "hello world", "world of code"}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %v after invalidation, got %v", expected, result)
+	}
+}
+
+func TestCachedIndexDisabled(t *testing.T) {
+	idx := NewCachedIndex([]string{"hello world"}, 0)
+	if idx.cache != nil {
+		t.Error("Expected caching to be disabled for zero capacity")
+	}
+	if got := idx.Find("world"); len(got) != 1 {
+		t.Errorf("Expected 1 match, got %v", got)
+	}
+}
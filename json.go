@@ -0,0 +1,102 @@
+package rkindex
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// indexJSON is the JSON representation of an index. The hash table's keys
+// are encoded as decimal strings, since JSON object keys must be strings.
+type indexJSON struct {
+	Strings         []string            `json:"strings"`
+	Positions       []int               `json:"positions,omitempty"`
+	Table           map[uint32][]string `json:"table"`
+	Common          []uint32            `json:"common,omitempty"`
+	MaxBucketSize   int                 `json:"maxBucketSize,omitempty"`
+	BruteForceLimit int                 `json:"bruteForceLimit"`
+	GramStrategy    GramStrategy        `json:"gramStrategy,omitempty"`
+	Ignore          string              `json:"ignore,omitempty"`
+	Seed            *uint32             `json:"seed,omitempty"` // nil for the default seed
+}
+
+// MarshalJSON encodes the index as JSON. The encoding is intended for
+// inspecting and comparing indexes rather than for compact storage.
+func (i *Index) MarshalJSON() ([]byte, error) {
+	v := indexJSON{
+		Strings:         i.strings,
+		Positions:       make([]int, len(i.strings)),
+		Table:           i.table,
+		MaxBucketSize:   i.maxBucket,
+		BruteForceLimit: i.bruteLimit,
+		GramStrategy:    i.strategy,
+		Ignore:          i.ignore,
+	}
+	for k, str := range i.strings {
+		v.Positions[k] = i.position[str]
+	}
+	if i.hasher.seed != prime0 {
+		v.Seed = &i.hasher.seed
+	}
+	for hash := range i.common {
+		v.Common = append(v.Common, hash)
+	}
+	slices.Sort(v.Common)
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON replaces the contents of the index with an index decoded
+// from JSON.
+func (i *Index) UnmarshalJSON(data []byte) error {
+	var v indexJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	if v.Positions != nil && len(v.Positions) != len(v.Strings) {
+		return errors.New("rkindex: mismatched string positions")
+	}
+
+	// Point every bucket entry at the first appearance of its string, so
+	// the decoded index interns its strings just as a built one does.
+	canonical := make(map[string]string, len(v.Strings))
+	for _, str := range v.Strings {
+		if _, ok := canonical[str]; !ok {
+			canonical[str] = str
+		}
+	}
+	for _, bucket := range v.Table {
+		for k, str := range bucket {
+			c, ok := canonical[str]
+			if !ok {
+				return fmt.Errorf("rkindex: bucket holds unknown string %q", str)
+			}
+			bucket[k] = c
+		}
+	}
+
+	i.setStrings(v.Strings, v.Positions)
+	i.setIgnore(v.Ignore)
+	i.maxLen = 0
+	for _, str := range i.strings {
+		i.maxLen = max(i.maxLen, len(i.key(str)))
+	}
+	i.table = v.Table
+	if i.table == nil {
+		i.table = make(map[uint32][]string)
+	}
+	i.common = nil
+	for _, hash := range v.Common {
+		i.markCommon(hash)
+	}
+	i.maxBucket = max(v.MaxBucketSize, 0)
+	i.bruteLimit = max(v.BruteForceLimit, 0)
+	i.strategy = v.GramStrategy
+	i.hasher = defaultHasher
+	if v.Seed != nil {
+		i.hasher = newHasher(*v.Seed)
+	}
+	i.generation++
+	return nil
+}
@@ -0,0 +1,112 @@
+package rkindex
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"unsafe"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func TestJSONRoundTrip(t *testing.T) {
+	indexes := map[string]*Index{
+		"default": NewIndex(smallCorpus()),
+		"limited": NewIndexWithBucketLimit(smallCorpus(), 2),
+		"empty":   NewIndex([]string{}),
+		"dupes":   NewIndex([]string{"hello", "hello", "world", "hello world"}),
+		"ignore":  NewIndexIgnoring([]string{"555-1234", "(555) 1234", "hello world"}, "-() "),
+		"seeded":  NewIndexSeeded(smallCorpus(), 12345),
+	}
+
+	for name, idx := range indexes {
+		data, err := json.Marshal(idx)
+		if err != nil {
+			t.Fatalf("%s: marshal failed: %v", name, err)
+		}
+
+		var decoded Index
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("%s: unmarshal failed: %v", name, err)
+		}
+
+		if !reflect.DeepEqual(decoded.strings, idx.strings) {
+			t.Errorf("%s: expected strings %v, got %v", name, idx.strings, decoded.strings)
+		}
+		if !reflect.DeepEqual(decoded.position, idx.position) {
+			t.Errorf("%s: expected positions %v, got %v", name, idx.position, decoded.position)
+		}
+		if decoded.hasher != idx.hasher {
+			t.Errorf("%s: expected seed %d, got %d", name, idx.hasher.seed, decoded.hasher.seed)
+		}
+		if len(decoded.table) != len(idx.table) || len(decoded.common) != len(idx.common) {
+			t.Errorf("%s: decoded hash table doesn't match", name)
+		}
+
+		// Bucket entries must share the data of the decoded strings.
+		canonical := make(map[string]*byte, len(decoded.strings))
+		for _, str := range decoded.strings {
+			canonical[str] = unsafe.StringData(str)
+		}
+		for _, bucket := range decoded.table {
+			for _, str := range bucket {
+				if unsafe.StringData(str) != canonical[str] {
+					t.Errorf("%s: bucket entry %q isn't interned", name, str)
+				}
+			}
+		}
+
+		checkSameResults(t, name, &decoded, idx)
+	}
+}
+
+func TestJSONGolden(t *testing.T) {
+	idx := NewIndexWithBucketLimit([]string{"hello", "help", "yellow", "cello"}, 2)
+
+	data, err := json.MarshalIndent(idx, "", "  ")
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+
+	golden := filepath.Join("testdata", "index.json")
+	if *update {
+		if err := os.WriteFile(golden, data, 0644); err != nil {
+			t.Fatalf("failed to update golden file: %v", err)
+		}
+	}
+
+	expected, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("failed to read golden file: %v", err)
+	}
+	if !bytes.Equal(data, expected) {
+		t.Errorf("JSON doesn't match golden file %s:\n%s", golden, data)
+	}
+}
+
+func TestJSONDuplicates(t *testing.T) {
+	var idx Index
+	if err := json.Unmarshal([]byte(`{"strings": ["a", "a", "ab"]}`), &idx); err != nil {
+		t.Fatalf("unmarshal failed: %v", err)
+	}
+	if expected := []string{"a", "ab"}; !reflect.DeepEqual(idx.strings, expected) {
+		t.Errorf("Expected strings %v, got %v", expected, idx.strings)
+	}
+}
+
+func TestJSONInvalid(t *testing.T) {
+	var idx Index
+	if err := json.Unmarshal([]byte(`{"table": {"abc": []}}`), &idx); err == nil {
+		t.Error("Expected error for non-numeric hash key")
+	}
+	if err := json.Unmarshal([]byte(`{"strings": ["a", "b"], "positions": [0]}`), &idx); err == nil {
+		t.Error("Expected error for mismatched positions")
+	}
+	if err := json.Unmarshal([]byte(`{"strings": ["abc"], "table": {"1": ["abc", "xyz"]}}`), &idx); err == nil {
+		t.Error("Expected error for unknown string in bucket")
+	}
+}
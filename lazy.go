@@ -0,0 +1,31 @@
+package rkindex
+
+import "sync"
+
+// LazyIndex is a search index that defers building its hash table until it
+// is first searched. It suits programs that load a corpus on every run but
+// only sometimes search it.
+type LazyIndex struct {
+	once  sync.Once
+	index *Index
+}
+
+// NewLazyIndex creates a lazily built index holding all provided strings.
+// Duplicate strings are removed immediately, but the strings' n-grams aren't
+// indexed until the first search.
+func NewLazyIndex(strings []string) *LazyIndex {
+	return &LazyIndex{index: newIndex(strings)}
+}
+
+// Index builds the index if it hasn't been built yet and returns it. The
+// build happens only once, even if Index is called concurrently.
+func (li *LazyIndex) Index() *Index {
+	li.once.Do(li.index.build)
+	return li.index
+}
+
+// Find builds the index if it hasn't been built yet, then searches it and
+// returns all substring matches.
+func (li *LazyIndex) Find(substr string) []string {
+	return li.Index().Find(substr)
+}
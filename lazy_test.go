@@ -0,0 +1,49 @@
+package rkindex
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func TestLazyIndex(t *testing.T) {
+	li := NewLazyIndex(smallCorpus())
+	if len(li.index.table) != 0 {
+		t.Fatalf("Expected empty hash table before the first search, got %d hashes", len(li.index.table))
+	}
+
+	// Concurrent first searches should build the index only once.
+	var wg sync.WaitGroup
+	results := make([][]string, 4)
+	for k := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[k] = li.Find("hello")
+		}()
+	}
+	wg.Wait()
+
+	idx := NewIndex(smallCorpus())
+	if !reflect.DeepEqual(li.index.table, idx.table) {
+		t.Error("Expected hash table to match an eagerly built index after the first search")
+	}
+
+	expected := []string{"hello code", "hello there", "hello world"}
+	for _, result := range results {
+		sort.Strings(result)
+		if !reflect.DeepEqual(result, expected) {
+			t.Errorf("Expected %v, got %v", expected, result)
+		}
+	}
+
+	result := li.Find("abcdef")
+	sort.Strings(result)
+	if expected := []string{"xabcdef"}; !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+	if li.Index() != li.index {
+		t.Error("Expected Index to return the built index")
+	}
+}
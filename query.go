@@ -0,0 +1,48 @@
+package rkindex
+
+// Query is a substring search whose n-gram hashes have been computed in
+// advance. A query isn't tied to any particular index, so it may be reused to
+// search any number of indexes.
+type Query struct {
+	substr string
+	seed   uint32   // seed the hashes were computed with
+	hashes []uint32 // hash of the n-gram at each offset of substr
+}
+
+// CompileQuery prepares a substring search, computing the hashes of the
+// substring's n-grams once so that repeated searches don't recompute them.
+// The hashes are computed with the default seed used by NewIndex.
+func CompileQuery(substr string) *Query {
+	q := &Query{substr: substr, seed: prime0}
+	var h uint32
+	eachNgram(substr, func(k int, ngram string) {
+		if k == 0 {
+			h = hash(ngram)
+		} else {
+			h = roll(h, substr[k-1], ngram[n-1])
+		}
+		q.hashes = append(q.hashes, h)
+	})
+	return q
+}
+
+// String returns the query's substring.
+func (q *Query) String() string {
+	return q.substr
+}
+
+// FindQuery searches the index using a compiled query and returns all
+// substring matches. The results are the same as those of Find for the
+// query's substring. Every query and index uses the same n-gram size, so a
+// query's hashes always cover the n-grams the index expects. They are only
+// used if they were computed with the index's seed and the substring
+// contains no characters ignored by the index; otherwise the hashes are
+// recomputed.
+// Unlike Find, FindQuery doesn't consult the index's result cache.
+func (i *Index) FindQuery(q *Query) []string {
+	var s scratch
+	if q.seed == i.hasher.seed && i.strip(q.substr) == q.substr {
+		s.hashes = q.hashes
+	}
+	return i.find(q.substr, &s)
+}
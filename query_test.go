@@ -0,0 +1,70 @@
+package rkindex
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestFindQuery(t *testing.T) {
+	for _, c := range findCases {
+		for _, limit := range []int{defaultBruteForceLimit, 0} {
+			idx := NewIndex(c.strings)
+			idx.SetBruteForceLimit(limit)
+
+			result := idx.FindQuery(CompileQuery(c.substring))
+			expected := idx.Find(c.substring)
+			sort.Strings(result)
+			sort.Strings(expected)
+			if !reflect.DeepEqual(result, expected) {
+				t.Errorf("%s: FindQuery(%q): expected %v, got %v", c.name, c.substring, expected, result)
+			}
+		}
+	}
+}
+
+func TestFindQueryReuse(t *testing.T) {
+	q := CompileQuery("hello")
+	if q.String() != "hello" {
+		t.Errorf("Expected query string %q, got %q", "hello", q.String())
+	}
+
+	// A query may be used to search several indexes, including those that
+	// ignore characters.
+	indexes := []*Index{
+		NewIndex(smallCorpus()),
+		NewIndexIgnoring([]string{"he-llo", "hello", "help"}, "-"),
+		NewIndexIgnoring([]string{"h.e.l.l.o", "hello", "help"}, "."),
+	}
+	for _, idx := range indexes {
+		idx.SetBruteForceLimit(0)
+		for _, q := range []*Query{q, CompileQuery("hel-lo"), CompileQuery("")} {
+			result := idx.FindQuery(q)
+			expected := idx.Find(q.String())
+			sort.Strings(result)
+			sort.Strings(expected)
+			if !reflect.DeepEqual(result, expected) {
+				t.Errorf("FindQuery(%q): expected %v, got %v", q, expected, result)
+			}
+		}
+	}
+
+	// Hashes computed with a different seed are recomputed.
+	idx := NewIndexSeeded(smallCorpus(), 7)
+	idx.SetBruteForceLimit(0)
+	if result := idx.FindQuery(q); len(result) != 3 {
+		t.Errorf("Expected 3 matches for mismatched seed, got %v", result)
+	}
+}
+
+// Benchmark repeated searches with a compiled query
+func BenchmarkFindQuery(b *testing.B) {
+	idx := NewIndex(largeCorpus())
+	q := CompileQuery("jumps 1a")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		idx.FindQuery(q)
+	}
+}
@@ -1,124 +1,1281 @@
 package rkindex
 
-import "slices"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"maps"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
 
 const (
 	// Length of n-grams used for indexing and searching
 	n = 3
 
-	// Prime numbers used by hash
+	// Default number of strings below which searches scan every string
+	// rather than using the index
+	defaultBruteForceLimit = 16
+
+	// Number of distinct strings the per-string data is sized for before
+	// the input is known to be mostly distinct
+	initialStrings = 1024
+
+	// Prime numbers used by hash. prime0 is the default initial hash state,
+	// or seed, and prime1 is the polynomial base used with it.
 	prime0 uint32 = 5381
 	prime1 uint32 = 1566083941
 )
 
+// ErrTooBroad is returned by FindBudget when a search has too many candidate
+// strings to verify.
+var ErrTooBroad = errors.New("rkindex: search is too broad")
+
+// InvalidUTF8Error is returned by NewIndexStrict when some of the provided
+// strings aren't valid UTF-8.
+type InvalidUTF8Error struct {
+	Indices []int // positions of the invalid strings in the input
+}
+
+func (e *InvalidUTF8Error) Error() string {
+	return fmt.Sprintf("rkindex: invalid UTF-8 in strings at indices %v", e.Indices)
+}
+
+// GramStrategy determines which of a substring's n-grams a search uses to
+// narrow down the candidate strings. Every strategy produces the same search
+// results, but they differ in how many candidates reach the final
+// verification and how many n-grams are examined to get there.
+type GramStrategy int
+
+const (
+	// OverlapTail examines consecutive non-overlapping n-grams and, if the
+	// substring's length isn't evenly divisible by n, a final n-gram built
+	// from the substring's last n characters. The final n-gram overlaps the
+	// one before it. This is the default strategy.
+	OverlapTail GramStrategy = iota
+
+	// SkipTail examines consecutive non-overlapping n-grams and ignores any
+	// trailing characters too few to fill an n-gram.
+	SkipTail
+)
+
+// next returns the offset of the n-gram to examine after the one at offset
+// off in a substring of the given length, or -1 if there are no more.
+func (g GramStrategy) next(off, length int) int {
+	off += n
+	switch {
+	case off+n <= length:
+		return off
+	case g == OverlapTail && off < length:
+		// If the remainder is shorter than an n-gram, build the final n-gram
+		// from the original substring's last n characters. This gives us some
+		// extra filtering power when the length of the substring isn't evenly
+		// divisible by n.
+		return length - n
+	default:
+		return -1
+	}
+}
+
 // Index is a search index used to quickly perform substring matches.
 type Index struct {
-	strings []string
-	table   map[uint32][]string
+	strings    []string
+	position   map[string]int    // position of each string in the input
+	keys       map[string]string // searchable form of each string, if ignoring
+	ignore     string            // characters ignored by searches
+	maxLen     int               // length of the longest searchable string
+	hasher     hasher            // hashes the index's n-grams
+	table      map[uint32][]string
+	common     map[uint32]bool // hashes too common to be worth indexing
+	maxBucket  int             // maximum bucket size, or 0 if unlimited
+	bruteLimit int             // size below which searches use brute force
+	strategy   GramStrategy    // selects the n-grams examined by searches
+	budget     *refBudget      // limits bucket references during a build, if non-nil
+	cache      *cache          // nil if query results aren't cached
+	generation uint64          // incremented whenever the index's contents change
 }
 
-// NewIndex builds a searchable index from all provided strings.
+// NewIndex builds a searchable index from all provided strings. Duplicate
+// strings are indexed only once, and the order in which each string first
+// appears is preserved.
+//
+// The index interns its strings: every reference to a string within the
+// index, including those in its hash buckets, shares the data of the
+// string's first appearance, so duplicate input doesn't add copies of the
+// string data to the index.
 func NewIndex(strings []string) *Index {
-	i := &Index{
-		strings: strings,
-		table:   make(map[uint32][]string),
+	i := newIndex(strings)
+	i.build()
+	return i
+}
+
+// NewIndexWithBucketLimit builds a searchable index from all provided
+// strings, limiting the number of strings stored under any one n-gram hash.
+// An n-gram found in more than maxBucketSize strings is considered too
+// common to narrow down a search, so its bucket is discarded and searches
+// skip over it. Search results are unaffected. A maxBucketSize of zero or
+// less means there is no limit.
+func NewIndexWithBucketLimit(strings []string, maxBucketSize int) *Index {
+	i := newIndex(strings)
+	i.maxBucket = max(maxBucketSize, 0)
+	i.build()
+	return i
+}
+
+// NewIndexMemBounded builds a searchable index from all provided strings,
+// limiting the total number of strings stored across all of the index's
+// hash buckets to maxBucketRefs. The limit holds throughout the build:
+// whenever adding a string to a bucket would exceed it, the largest bucket
+// at that moment is discarded, and its hash is treated as too common to
+// index, as with NewIndexWithBucketLimit. Search results are unaffected. A
+// maxBucketRefs of zero or less means there is no limit.
+func NewIndexMemBounded(strings []string, maxBucketRefs int) *Index {
+	i := newIndex(strings)
+	if maxBucketRefs > 0 {
+		i.budget = newRefBudget(maxBucketRefs)
 	}
-	for _, str := range strings {
-		for s := str; len(s) >= n; s = s[1:] {
-			hash := hash(s[:n])
-			i.updateHash(hash, str)
+	i.build()
+	i.budget = nil
+	return i
+}
+
+// NewIndexSeeded builds a searchable index from all provided strings,
+// using seed as the initial state when hashing n-grams. The seed also
+// selects the hash's polynomial base, so indexes built with different seeds
+// not only store the same n-grams under different hashes, but also differ in
+// which n-grams share a hash. Search results are unaffected. NewIndex uses a
+// seed of 5381.
+func NewIndexSeeded(strings []string, seed uint32) *Index {
+	i := newIndex(strings)
+	i.hasher = newHasher(seed)
+	i.build()
+	return i
+}
+
+// NewIndexSized builds a searchable index from all provided strings,
+// allocating room in the index's hash table for the expected number of
+// distinct n-gram hashes up front. This avoids repeatedly growing the table
+// while building a large index. The resulting index is identical to one
+// built by NewIndex.
+func NewIndexSized(strings []string, expectedBuckets int) *Index {
+	i := newIndex(strings)
+	i.table = make(map[uint32][]string, max(expectedBuckets, 0))
+	i.build()
+	return i
+}
+
+// NewIndexIgnoring builds a searchable index from all provided strings,
+// ignoring every character in ignore when indexing and searching. Ignored
+// characters are removed from both the indexed strings and the searched
+// substrings before they are compared, but searches return the strings in
+// their original form. For example, an index of phone numbers ignoring
+// "-() " matches "(555) 123-4567" when searching for "5551234".
+func NewIndexIgnoring(strings []string, ignore string) *Index {
+	i := newIndex(strings)
+	i.setIgnore(ignore)
+	i.build()
+	return i
+}
+
+// NewIndexStrict builds a searchable index from all provided strings that
+// are valid UTF-8. If any string is invalid and skipInvalid is false, no
+// index is built and an *InvalidUTF8Error listing the positions of every
+// invalid string is returned. If skipInvalid is true, the invalid strings
+// are left out of the index, and the remaining strings keep their positions
+// in the input.
+func NewIndexStrict(strings []string, skipInvalid bool) (*Index, error) {
+	var invalid []int
+	for k, str := range strings {
+		if !utf8.ValidString(str) {
+			invalid = append(invalid, k)
+		}
+	}
+	if len(invalid) == 0 {
+		return NewIndex(strings), nil
+	}
+	if !skipInvalid {
+		return nil, &InvalidUTF8Error{Indices: invalid}
+	}
+
+	valid := make([]string, 0, len(strings)-len(invalid))
+	positions := make([]int, 0, len(strings)-len(invalid))
+	for k, str := range strings {
+		if len(invalid) > 0 && invalid[0] == k {
+			invalid = invalid[1:]
+			continue
 		}
+		valid = append(valid, str)
+		positions = append(positions, k)
+	}
+
+	i := newIndex(nil)
+	i.setStrings(valid, positions)
+	i.build()
+	return i, nil
+}
+
+// NewIndexFromKeys builds a searchable index from the keys of a map. The
+// strings returned by a search may be used to look up their associated values
+// in the map. Because map iteration order is unspecified, so is the order of
+// the index's strings.
+func NewIndexFromKeys[V any](m map[string]V) *Index {
+	strings := make([]string, 0, len(m))
+	for key := range m {
+		strings = append(strings, key)
+	}
+	return NewIndex(strings)
+}
+
+// NewCachedIndex builds a searchable index from all provided strings. The
+// index caches the results of up to capacity recent Find queries. Cached
+// results are discarded whenever the index's contents change. A capacity of
+// zero or less disables caching.
+func NewCachedIndex(strings []string, capacity int) *Index {
+	i := NewIndex(strings)
+	if capacity > 0 {
+		i.cache = newCache(capacity)
 	}
 	return i
 }
 
-// updateHash adds a string to the index under the given hash.
-func (i *Index) updateHash(hash uint32, str string) {
-	if strings, ok := i.table[hash]; ok {
-		if !slices.Contains(strings, str) {
-			i.table[hash] = append(i.table[hash], str)
+// newIndex creates an index holding the strings, with an empty hash table.
+func newIndex(strings []string) *Index {
+	i := &Index{
+		table:      make(map[uint32][]string),
+		bruteLimit: defaultBruteForceLimit,
+		hasher:     defaultHasher,
+	}
+	i.setStrings(strings, nil)
+	return i
+}
+
+// setStrings sets the index's strings, removing duplicates while preserving
+// the order in which each string first appears. It records the position of
+// each string's first appearance, which is taken from positions if non-nil.
+func (i *Index) setStrings(strings []string, positions []int) {
+	// Size the per-string data for a modest number of distinct strings at
+	// first, and for all of the strings once that many have been seen.
+	// Distinct input then allocates its data at full size almost at once,
+	// while duplicate-heavy input allocates little more than it needs.
+	hint := min(len(strings), initialStrings)
+	i.strings = make([]string, 0, hint)
+	i.position = make(map[string]int, hint)
+	for k, str := range strings {
+		if _, ok := i.position[str]; ok {
+			continue
 		}
-	} else {
-		i.table[hash] = []string{str}
+		if len(i.strings) == hint && hint < len(strings) {
+			hint = len(strings)
+			i.strings = slices.Grow(i.strings, hint-len(i.strings))
+			position := make(map[string]int, hint)
+			maps.Copy(position, i.position)
+			i.position = position
+		}
+		if positions != nil {
+			i.position[str] = positions[k]
+		} else {
+			i.position[str] = k
+		}
+		i.strings = append(i.strings, str)
+	}
+
+	// If the strings fill less than half of what was allocated for them,
+	// reallocate at the distinct count rather than hold on to the excess
+	// for the life of the index.
+	if len(i.strings) < cap(i.strings)/2 {
+		strings := make([]string, len(i.strings))
+		copy(strings, i.strings)
+		i.strings = strings
+		position := make(map[string]int, len(i.strings))
+		for _, str := range i.strings {
+			position[str] = i.position[str]
+		}
+		i.position = position
+	}
+}
+
+// setIgnore sets the characters ignored by the index and records the
+// searchable form of each of the index's strings.
+func (i *Index) setIgnore(ignore string) {
+	i.ignore = ignore
+	i.keys = nil
+	if ignore != "" {
+		i.keys = make(map[string]string, len(i.strings))
+		for _, str := range i.strings {
+			i.keys[str] = i.strip(str)
+		}
+	}
+}
+
+// strip removes the characters ignored by the index from a string. Bytes
+// that aren't valid UTF-8 are never ignored, and are kept as they are.
+func (i *Index) strip(str string) string {
+	if i.ignore == "" {
+		return str
+	}
+
+	var b strings.Builder
+	start := 0 // start of the bytes not yet copied to b
+	removed := false
+	for k := 0; k < len(str); {
+		r, size := utf8.DecodeRuneInString(str[k:])
+		invalid := r == utf8.RuneError && size == 1
+		if !invalid && strings.ContainsRune(i.ignore, r) {
+			b.WriteString(str[start:k])
+			start = k + size
+			removed = true
+		}
+		k += size
+	}
+	if !removed {
+		return str
+	}
+	b.WriteString(str[start:])
+	return b.String()
+}
+
+// key returns the searchable form of one of the index's strings.
+func (i *Index) key(str string) string {
+	if i.keys == nil {
+		return str
+	}
+	return i.keys[str]
+}
+
+// build adds the n-grams of all the index's strings to the hash table.
+func (i *Index) build() {
+	for _, str := range i.strings {
+		key := i.key(str)
+		i.maxLen = max(i.maxLen, len(key))
+		var h uint32
+		eachNgram(key, func(k int, ngram string) {
+			if k == 0 {
+				h = i.hash(ngram)
+			} else {
+				h = i.roll(h, key[k-1], ngram[n-1])
+			}
+			i.appendHash(h, str)
+		})
+	}
+}
+
+// appendHash adds a string to the index under the given hash. It only checks
+// the last string in the hash's bucket for a duplicate. This is sufficient
+// while building an index, because the index's strings are unique and all
+// of a string's n-grams are added before those of the next string. If the
+// hash's bucket would grow beyond the index's maximum bucket size, the
+// bucket is discarded and the hash is marked as too common to index. If the
+// buckets would hold more strings than the index's budget allows, the
+// largest bucket is discarded in the same way first.
+func (i *Index) appendHash(hash uint32, str string) {
+	if i.common[hash] {
+		return
+	}
+	bucket := i.table[hash]
+	if len(bucket) > 0 && bucket[len(bucket)-1] == str {
+		return
+	}
+	if i.maxBucket > 0 && len(bucket) >= i.maxBucket {
+		i.markCommon(hash)
+		return
+	}
+	if i.budget != nil && i.budget.full() {
+		largest := i.budget.largest()
+		i.markCommon(largest)
+		if largest == hash {
+			return
+		}
+	}
+
+	i.table[hash] = append(bucket, str)
+	if i.budget != nil {
+		i.budget.grow(hash, len(bucket)+1)
+	}
+}
+
+// markCommon discards a hash's bucket and marks the hash as too common to
+// index.
+func (i *Index) markCommon(hash uint32) {
+	if i.common == nil {
+		i.common = make(map[uint32]bool)
+	}
+	i.common[hash] = true
+	if i.budget != nil {
+		i.budget.remove(hash, len(i.table[hash]))
+	}
+	delete(i.table, hash)
+}
+
+// All returns an iterator over the index's strings and their positions
+// within the index, in order. The strings are read directly from the index
+// without being copied. The index provides no synchronization, so it must not
+// be modified while being iterated.
+func (i *Index) All() iter.Seq2[int, string] {
+	return func(yield func(int, string) bool) {
+		for k, str := range i.strings {
+			if !yield(k, str) {
+				return
+			}
+		}
+	}
+}
+
+// Clone returns a deep copy of the index. The clone shares no mutable state
+// with the original, so either may be modified without affecting the other.
+func (i *Index) Clone() *Index {
+	c := &Index{
+		strings:    slices.Clone(i.strings),
+		position:   maps.Clone(i.position),
+		keys:       maps.Clone(i.keys),
+		ignore:     i.ignore,
+		maxLen:     i.maxLen,
+		hasher:     i.hasher,
+		table:      make(map[uint32][]string, len(i.table)),
+		common:     maps.Clone(i.common),
+		maxBucket:  i.maxBucket,
+		bruteLimit: i.bruteLimit,
+		strategy:   i.strategy,
+	}
+	for hash, bucket := range i.table {
+		c.table[hash] = slices.Clone(bucket)
+	}
+	if i.cache != nil {
+		c.cache = newCache(i.cache.capacity)
+	}
+	return c
+}
+
+// SetBruteForceLimit sets the number of strings below which searches scan
+// every string directly rather than using the index. For small indexes, the
+// overhead of narrowing down candidates with the index exceeds the cost of a
+// direct scan. A limit of zero or less means searches always use the index.
+// The default limit is 16.
+func (i *Index) SetBruteForceLimit(limit int) {
+	i.bruteLimit = max(limit, 0)
+}
+
+// SetGramStrategy sets the strategy used to select which of a substring's
+// n-grams are examined when searching. The default is OverlapTail.
+func (i *Index) SetGramStrategy(strategy GramStrategy) {
+	i.strategy = strategy
+}
+
+// Compact releases unused capacity held by the index. It trims the strings
+// list and every hash bucket to their current lengths, deletes any empty
+// buckets, and rebuilds the tables of per-string data. Query results are
+// unaffected. Compact is an O(total n-grams) operation, so it is meant to be
+// run occasionally rather than after every change to the index.
+func (i *Index) Compact() {
+	strings := make([]string, len(i.strings))
+	copy(strings, i.strings)
+	i.strings = strings
+
+	position := make(map[string]int, len(i.strings))
+	for _, str := range i.strings {
+		position[str] = i.position[str]
+	}
+	i.position = position
+	i.setIgnore(i.ignore)
+
+	for hash, bucket := range i.table {
+		if len(bucket) == 0 {
+			delete(i.table, hash)
+			continue
+		}
+		if cap(bucket) > len(bucket) {
+			trimmed := make([]string, len(bucket))
+			copy(trimmed, bucket)
+			i.table[hash] = trimmed
+		}
+	}
+}
+
+// RemoveFunc removes every string for which pred returns true and returns
+// the number of strings removed. The removed strings are dropped from every
+// hash bucket in a single pass over the hash table, which is much cheaper
+// than removing strings one at a time. Hashes marked as too common to index
+// remain marked.
+func (i *Index) RemoveFunc(pred func(string) bool) int {
+	removed := make(map[string]bool)
+	kept := make([]string, 0, len(i.strings))
+	maxLen := 0
+	for _, str := range i.strings {
+		if pred(str) {
+			removed[str] = true
+			delete(i.position, str)
+			delete(i.keys, str)
+		} else {
+			kept = append(kept, str)
+			maxLen = max(maxLen, len(i.key(str)))
+		}
+	}
+	if len(removed) == 0 {
+		return 0
 	}
+	i.strings = kept
+	i.maxLen = maxLen
+
+	for hash, bucket := range i.table {
+		bucket = slices.DeleteFunc(bucket, func(str string) bool {
+			return removed[str]
+		})
+		if len(bucket) == 0 {
+			delete(i.table, hash)
+		} else {
+			i.table[hash] = bucket
+		}
+	}
+	i.generation++
+	return len(removed)
 }
 
-// Find searches the index and returns all substring matches.
+// Find searches the index and returns all substring matches. An empty
+// substring matches every string. Whitespace is matched like any other
+// character, so a substring consisting only of spaces matches the strings
+// containing that exact run of spaces. The returned slice belongs to the
+// caller and may be modified freely.
 func (i *Index) Find(substr string) []string {
+	if i.cache != nil {
+		if result, ok := i.cache.get(substr, i.generation); ok {
+			return result
+		}
+	}
+
+	var s scratch
+	result := i.find(substr, &s)
+
+	if i.cache != nil {
+		i.cache.put(substr, i.generation, result)
+	}
+	return result
+}
+
+// FindBatch searches the index for each of the substrings and returns their
+// matches in the same order. It produces the same results as calling Find
+// for each substring, but reuses its working memory across the searches.
+func (i *Index) FindBatch(substrs []string) [][]string {
+	var s scratch
+	results := make([][]string, len(substrs))
+	for k, substr := range substrs {
+		results[k] = i.find(substr, &s)
+	}
+	return results
+}
+
+// IndexedMatch is a string matched by a search, along with its position.
+type IndexedMatch struct {
+	Index  int    // position of the string in the slice used to build the index
+	String string // the matched string
+}
+
+// FindBudget searches the index and returns all substring matches, unless
+// narrowing down the index's strings using the substring's n-grams leaves
+// more than maxCandidates strings to be verified. In that case, it returns
+// ErrTooBroad without verifying the candidates. If the substring is searched
+// by scanning every string, all of the index's strings are candidates.
+func (i *Index) FindBudget(substr string, maxCandidates int) ([]string, error) {
+	substr = i.strip(substr)
+	match := func(key string) bool {
+		return contains(key, substr)
+	}
+
+	if len(substr) > i.maxLen {
+		return []string{}, nil
+	}
+	if i.bruteForce(substr) {
+		if len(i.strings) > maxCandidates {
+			return nil, ErrTooBroad
+		}
+		return i.bruteForceSearch(match), nil
+	}
+
+	var s scratch
+	if !i.filter(substr, &s) {
+		return []string{}, nil
+	}
+	if len(s.candidates) > maxCandidates {
+		return nil, ErrTooBroad
+	}
+	return i.verify(&s, match), nil
+}
+
+// FindDetailed searches the index and returns all substring matches, along
+// with the number of candidate strings that had to be verified to find them.
+// Comparing the two measures how selective the index is for the substring.
+// If the substring is searched by scanning every string, all of the index's
+// strings are candidates.
+func (i *Index) FindDetailed(substr string) (matches []string, candidateCount int) {
+	substr = i.strip(substr)
+	match := func(key string) bool {
+		return contains(key, substr)
+	}
+
+	if len(substr) > i.maxLen {
+		return []string{}, 0
+	}
+	if i.bruteForce(substr) {
+		return i.bruteForceSearch(match), len(i.strings)
+	}
+
+	var s scratch
+	if !i.filter(substr, &s) {
+		return []string{}, 0
+	}
+	return i.verify(&s, match), len(s.candidates)
+}
+
+// FindWithIndices searches the index and returns all substring matches
+// along with their positions in the slice of strings the index was built
+// from, in order of position. If a string appeared in the slice more than
+// once, the position of its first appearance is returned.
+func (i *Index) FindWithIndices(substr string) []IndexedMatch {
+	var s scratch
+	matches := i.find(substr, &s)
+
+	result := make([]IndexedMatch, len(matches))
+	for k, str := range matches {
+		result[k] = IndexedMatch{Index: i.position[str], String: str}
+	}
+	slices.SortFunc(result, func(a, b IndexedMatch) int {
+		return a.Index - b.Index
+	})
+	return result
+}
+
+// ScoredMatch is a string found by a search, along with the number of the
+// search's n-grams whose hash buckets held the string and whether the
+// string was confirmed to contain the substring.
+type ScoredMatch struct {
+	String    string // the candidate string
+	NgramHits int    // number of examined n-grams whose buckets held the string
+	Verified  bool   // true if the string contains the substring
+}
+
+// FindWithScores searches the index and returns every string held by the
+// hash bucket of at least one of the substring's examined n-grams, along
+// with the number of examined n-grams whose buckets held it. Rather than
+// intersecting the buckets, it counts how many buckets hold each string.
+// Only strings held by every examined n-gram's bucket are checked against
+// the substring, and those containing it are marked as verified; the
+// verified strings are exactly the ones Find returns. N-grams skipped as too
+// common are not examined and never count as hits.
+//
+// Like Find, FindWithScores doesn't consult the buckets when the substring
+// is shorter than an n-gram, when the index is smaller than its brute force
+// limit, or when every n-gram is too common. It then scans every string
+// directly and returns only the matches, verified and without hits. A
+// substring longer than every string has no results.
+//
+// Results are returned in order of decreasing hits, with verified strings
+// before unverified ones among equal hits, then alphabetically.
+func (i *Index) FindWithScores(substr string) []ScoredMatch {
+	substr = i.strip(substr)
+	result := make([]ScoredMatch, 0)
+	if len(substr) > i.maxLen {
+		// No string is long enough to contain the substring.
+		return result
+	}
+
+	hits := make(map[string]int)
+	examined := 0
+	if !i.bruteForce(substr) {
+		ngrams := Ngrams(substr)
+		for off := 0; off >= 0; off = i.strategy.next(off, len(substr)) {
+			hash := i.hash(ngrams[off])
+			if i.common[hash] {
+				continue
+			}
+			examined++
+			for _, str := range i.getMatches(hash) {
+				hits[str]++
+			}
+		}
+	}
+
+	if examined == 0 {
+		for _, str := range i.strings {
+			if contains(i.key(str), substr) {
+				result = append(result, ScoredMatch{String: str, Verified: true})
+			}
+		}
+	} else {
+		for str, count := range hits {
+			verified := count == examined && contains(i.key(str), substr)
+			result = append(result, ScoredMatch{String: str, NgramHits: count, Verified: verified})
+		}
+	}
+
+	slices.SortFunc(result, func(a, b ScoredMatch) int {
+		if a.NgramHits != b.NgramHits {
+			return b.NgramHits - a.NgramHits
+		}
+		if a.Verified != b.Verified {
+			if a.Verified {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a.String, b.String)
+	})
+	return result
+}
+
+// CollisionStats describes how the distinct n-grams of an index's strings
+// are distributed across hashes.
+type CollisionStats struct {
+	Ngrams           int // number of distinct n-grams
+	Hashes           int // number of distinct hashes of the n-grams
+	Collisions       int // number of hashes shared by more than one n-gram
+	MaxNgramsPerHash int // largest number of n-grams sharing a hash
+}
+
+// Rate returns the fraction of hashes shared by more than one n-gram.
+func (c CollisionStats) Rate() float64 {
+	if c.Hashes == 0 {
+		return 0
+	}
+	return float64(c.Collisions) / float64(c.Hashes)
+}
+
+// CollisionReport analyzes the n-grams of the index's strings and reports
+// how many distinct n-grams share each hash. Strings sharing a hash but not
+// an n-gram inflate the hash's bucket and produce extra candidates in
+// searches. The analysis collects every distinct n-gram, so it takes time
+// and memory proportional to the index's total n-grams.
+//
+// For n-grams of 3 bytes, the hash happens to be collision-free, so the
+// report is mostly useful as a check when changing the n-gram size or hash.
+func (i *Index) CollisionReport() CollisionStats {
+	return i.collisionReport(i.hash)
+}
+
+// collisionReport analyzes the n-grams of the index's strings using the
+// given hash function.
+func (i *Index) collisionReport(hash func(string) uint32) CollisionStats {
+	ngrams := make(map[string]uint32)
+	for _, str := range i.strings {
+		eachNgram(i.key(str), func(_ int, ngram string) {
+			if _, ok := ngrams[ngram]; !ok {
+				ngrams[ngram] = hash(ngram)
+			}
+		})
+	}
+
+	counts := make(map[uint32]int)
+	for _, h := range ngrams {
+		counts[h]++
+	}
+
+	stats := CollisionStats{Ngrams: len(ngrams), Hashes: len(counts)}
+	for _, count := range counts {
+		if count > 1 {
+			stats.Collisions++
+		}
+		stats.MaxNgramsPerHash = max(stats.MaxNgramsPerHash, count)
+	}
+	return stats
+}
+
+// FindExplanation describes how Find narrows down the candidate strings for
+// a substring search. It is intended for diagnosing query selectivity.
+type FindExplanation struct {
+	// BruteForce is true if the substring is too short to be searched using
+	// n-grams or the index is below its brute force limit, in which case
+	// every string in the index is scanned.
+	BruteForce bool
+
+	// TooLong is true if the substring is longer than every string in the
+	// index, in which case no string is examined at all.
+	TooLong bool
+
+	// Steps holds one entry for each n-gram examined, in order. Examination
+	// stops early if the candidate set becomes empty.
+	Steps []ExplainStep
+}
+
+// ExplainStep describes the examination of a single n-gram during a search.
+type ExplainStep struct {
+	Ngram      string // the n-gram taken from the substring
+	Hash       uint32 // the n-gram's hash
+	BucketSize int    // number of strings in the hash's bucket
+	Candidates int    // number of candidates remaining after the n-gram
+	Skipped    bool   // true if the n-gram was too common to filter on
+	Repeated   bool   // true if the n-gram's hash repeated the previous one
+}
+
+// Explain reports how Find narrows down the candidate strings when searching
+// for the substring.
+func (i *Index) Explain(substr string) FindExplanation {
+	substr = i.strip(substr)
+	var e FindExplanation
+	if len(substr) > i.maxLen {
+		e.TooLong = true
+		return e
+	}
+	if i.bruteForce(substr) {
+		e.BruteForce = true
+		return e
+	}
+
+	s := scratch{explain: &e}
+	i.filter(substr, &s)
+	return e
+}
+
+// scratch holds the candidate sets used by find. It may be reused across
+// multiple searches to avoid reallocating the sets.
+type scratch struct {
+	candidates map[string]bool
+	tmp        map[string]bool
+	ngrams     []string         // n-grams of the substring being searched
+	hashes     []uint32         // precomputed hashes of the n-grams, if non-nil
+	explain    *FindExplanation // if non-nil, filter records its steps here
+}
+
+// find searches the index and returns all substring matches, using s to
+// hold the candidate sets.
+func (i *Index) find(substr string, s *scratch) []string {
+	substr = i.strip(substr)
 	if len(substr) == 0 {
-		return i.strings
+		return slices.Clone(i.strings)
 	}
-	if len(substr) < n {
-		return i.bruteForceSearch(substr)
+	if len(substr) > i.maxLen {
+		// No string is long enough to contain the substring.
+		return []string{}
+	}
+	return i.search(substr, s, func(key string) bool {
+		return contains(key, substr)
+	})
+}
+
+// search narrows down the index's strings to the candidates containing the
+// n-grams of substr and returns the candidates whose searchable forms are
+// accepted by match. Unless every string is scanned, match only sees strings
+// containing substr's n-grams, so it should only accept strings containing
+// them. The substring must already have had ignored characters removed.
+func (i *Index) search(substr string, s *scratch, match func(key string) bool) []string {
+	if i.bruteForce(substr) {
+		return i.bruteForceSearch(match)
+	}
+
+	if !i.filter(substr, s) {
+		return []string{}
 	}
+	return i.verify(s, match)
+}
 
-	var candidates, tmp map[string]bool
+// verify returns the candidates whose searchable forms are accepted by
+// match.
+func (i *Index) verify(s *scratch, match func(key string) bool) []string {
+	result := make([]string, 0, len(s.candidates))
+	for str := range s.candidates {
+		if match(i.key(str)) {
+			result = append(result, str)
+		}
+	}
+	return result
+}
 
-	remain := substr
-	for {
-		ngram := remain[:n]
-		hash := hash(ngram)
+// filter narrows s.candidates down to the strings containing the n-grams of
+// a substring at least n characters long. It returns false if no candidates
+// remain.
+func (i *Index) filter(substr string, s *scratch) bool {
+	s.ngrams = appendNgrams(s.ngrams[:0], substr)
+
+	first := true
+	var prev uint32 // hash of the last n-gram to narrow down the candidates
+	for off := 0; off >= 0; off = i.strategy.next(off, len(substr)) {
+		ngram := s.ngrams[off]
+		var hash uint32
+		if s.hashes != nil {
+			hash = s.hashes[off]
+		} else {
+			hash = i.hash(ngram)
+		}
+
+		// An n-gram too common to be indexed can't narrow down the
+		// candidates, so leave it for the final verification.
+		if i.common[hash] {
+			s.skip(ngram, hash, first, len(i.strings))
+			continue
+		}
 
 		matches := i.getMatches(hash)
 		if len(matches) == 0 {
-			return []string{}
+			s.record(ngram, hash, 0, 0)
+			return false
 		}
 
-		if candidates == nil {
-			candidates = make(map[string]bool, len(matches))
-			tmp = make(map[string]bool, len(matches))
+		if first {
+			s.reset(len(matches))
 			for _, str := range matches {
-				candidates[str] = true
+				s.candidates[str] = true
 			}
+			first = false
+		} else if hash == prev {
+			// Intersecting the candidates with the bucket they were just
+			// intersected with would leave them unchanged, so skip the
+			// pass. This saves work for repetitive substrings like "aaaaaa".
+			s.repeat(ngram, hash, len(matches))
+			continue
 		} else {
 			for _, str := range matches {
-				if candidates[str] {
-					tmp[str] = true
+				if s.candidates[str] {
+					s.tmp[str] = true
 				}
 			}
-			candidates, tmp = tmp, candidates
-			clear(tmp)
-			if len(candidates) == 0 {
-				return []string{}
-			}
+			s.candidates, s.tmp = s.tmp, s.candidates
+			clear(s.tmp)
 		}
+		prev = hash
 
-		remain = remain[n:]
-		if len(remain) == 0 {
-			break
+		s.record(ngram, hash, len(matches), len(s.candidates))
+		if len(s.candidates) == 0 {
+			return false
 		}
+	}
 
-		// If the remainder is shorter than an n-gram, build the final n-gram
-		// from the original substring's last n characters. This gives us some
-		// extra filtering power when the length of the substring isn't evenly
-		// divisible by n.
-		if len(remain) < n {
-			remain = substr[len(substr)-n:]
+	// If every n-gram was skipped, every string is a candidate.
+	if first {
+		s.reset(len(i.strings))
+		for _, str := range i.strings {
+			s.candidates[str] = true
 		}
 	}
+	return len(s.candidates) > 0
+}
+
+// reset empties the candidate sets, allocating them with the size hint if
+// they don't yet exist.
+func (s *scratch) reset(hint int) {
+	if s.candidates == nil {
+		s.candidates = make(map[string]bool, hint)
+		s.tmp = make(map[string]bool, hint)
+	} else {
+		clear(s.candidates)
+	}
+}
+
+// record adds a step to the explanation being gathered, if any.
+func (s *scratch) record(ngram string, hash uint32, bucketSize, candidates int) {
+	if s.explain != nil {
+		s.explain.Steps = append(s.explain.Steps, ExplainStep{
+			Ngram:      ngram,
+			Hash:       hash,
+			BucketSize: bucketSize,
+			Candidates: candidates,
+		})
+	}
+}
 
-	result := make([]string, 0, len(candidates))
-	for str := range candidates {
-		if contains(str, substr) {
+// repeat adds a step to the explanation being gathered, if any, for an
+// n-gram whose hash repeated the previous one and so left the candidates
+// unchanged.
+func (s *scratch) repeat(ngram string, hash uint32, bucketSize int) {
+	if s.explain != nil {
+		s.explain.Steps = append(s.explain.Steps, ExplainStep{
+			Ngram:      ngram,
+			Hash:       hash,
+			BucketSize: bucketSize,
+			Candidates: len(s.candidates),
+			Repeated:   true,
+		})
+	}
+}
+
+// skip adds a skipped step to the explanation being gathered, if any. If no
+// n-gram has yet narrowed down the candidates, all strings are candidates.
+func (s *scratch) skip(ngram string, hash uint32, first bool, all int) {
+	if s.explain != nil {
+		candidates := all
+		if !first {
+			candidates = len(s.candidates)
+		}
+		s.explain.Steps = append(s.explain.Steps, ExplainStep{
+			Ngram:      ngram,
+			Hash:       hash,
+			Candidates: candidates,
+			Skipped:    true,
+		})
+	}
+}
+
+// MayContain reports whether any string in the index might contain the
+// substring. It examines only the substring's n-grams, without verifying
+// that a candidate string actually contains the substring, so it is cheaper
+// than Find. It may report false positives, such as when a string contains
+// all of the substring's n-grams but not contiguously. It never reports
+// false negatives: if MayContain returns false, Find returns no matches.
+func (i *Index) MayContain(substr string) bool {
+	substr = i.strip(substr)
+	if i.bruteForce(substr) {
+		for _, str := range i.strings {
+			if contains(i.key(str), substr) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var s scratch
+	return i.filter(substr, &s)
+}
+
+// FindNotContaining searches the index and returns all strings that do not
+// contain the substring. It is the complement of Find, so an empty substring
+// returns no strings.
+func (i *Index) FindNotContaining(substr string) []string {
+	matches := i.Find(substr)
+	matched := make(map[string]bool, len(matches))
+	for _, str := range matches {
+		matched[str] = true
+	}
+
+	result := make([]string, 0, len(i.strings)-len(matches))
+	for _, str := range i.strings {
+		if !matched[str] {
 			result = append(result, str)
 		}
 	}
+	return result
+}
 
+// FindChan searches the index and sends each substring match on the
+// returned channel, closing the channel when the search is complete. Matches
+// are sent as they are verified, so the full set of matches is never held in
+// memory at once. Canceling the context stops the search and closes the
+// channel, so callers that stop reading early should cancel the context.
+// The index must not be modified until the channel is closed.
+func (i *Index) FindChan(ctx context.Context, substr string) <-chan string {
+	substr = i.strip(substr)
+	out := make(chan string)
+	go func() {
+		defer close(out)
+
+		send := func(str string) bool {
+			select {
+			case out <- str:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		if i.bruteForce(substr) {
+			for _, str := range i.strings {
+				if contains(i.key(str), substr) && !send(str) {
+					return
+				}
+			}
+			return
+		}
+
+		var s scratch
+		if !i.filter(substr, &s) {
+			return
+		}
+		for str := range s.candidates {
+			if contains(i.key(str), substr) && !send(str) {
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// FindLenRange searches the index and returns all substring matches whose
+// lengths in bytes are at least minLen and at most maxLen. A maxLen of zero
+// or less means matches have no maximum length.
+func (i *Index) FindLenRange(substr string, minLen, maxLen int) []string {
+	substr = i.strip(substr)
+
+	var s scratch
+	result := i.search(substr, &s, func(key string) bool {
+		return contains(key, substr)
+	})
+	return slices.DeleteFunc(result, func(str string) bool {
+		return len(str) < minLen || (maxLen > 0 && len(str) > maxLen)
+	})
+}
+
+// FindUnverified searches the index and returns every candidate string
+// containing all of the substring's examined n-grams, without verifying that
+// the candidates actually contain the substring.
+//
+// WARNING: FindUnverified returns false positives. A string containing all of
+// a substring's n-grams need not contain the substring itself, because the
+// n-grams may appear out of order or apart from one another; for example,
+// "abcXdefXghi" is returned for the substring "abcdefghi". Strings may also
+// be returned because of hash collisions, and an n-gram too common to be
+// indexed doesn't narrow down the candidates at all. Only use FindUnverified
+// when the data is known never to exhibit these patterns, or when false
+// positives are acceptable.
+//
+// Substrings shorter than an n-gram can't be narrowed down by the index, so
+// their matches are verified as usual.
+func (i *Index) FindUnverified(substr string) []string {
+	substr = i.strip(substr)
+	if len(substr) < n {
+		return i.find(substr, &scratch{})
+	}
+
+	var s scratch
+	if !i.filter(substr, &s) {
+		return []string{}
+	}
+	result := make([]string, 0, len(s.candidates))
+	for str := range s.candidates {
+		result = append(result, str)
+	}
 	return result
 }
 
-// bruteForceSearch performs a direct search through all strings. Used
-// for short substring searches.
-func (i *Index) bruteForceSearch(substr string) []string {
+// LongestMatchingPrefix finds the longest prefix of the substring that is
+// found in the index, returning the prefix and its matches. Prefixes are
+// trimmed a whole character at a time. If even the empty prefix has no
+// matches, which is only the case for an empty index, the prefix is empty
+// and there are no matches.
+//
+// Any prefix of a matching prefix also matches, so the longest matching
+// prefix is found with a binary search, requiring only a logarithmic number
+// of searches. Searches for prefixes that aren't found usually end without
+// verifying any candidates, as soon as one of their n-grams is missing from
+// the index.
+func (i *Index) LongestMatchingPrefix(substr string) (string, []string) {
+	// The lengths of the prefixes ending at character boundaries.
+	ends := make([]int, 0, len(substr)+1)
+	for k := range substr {
+		ends = append(ends, k)
+	}
+	ends = append(ends, len(substr))
+
+	var s scratch
+	best := i.find("", &s)
+	if len(best) == 0 {
+		return "", best
+	}
+
+	lo, hi := 0, len(ends)-1
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if matches := i.find(substr[:ends[mid]], &s); len(matches) > 0 {
+			lo, best = mid, matches
+		} else {
+			hi = mid - 1
+		}
+	}
+	return substr[:ends[lo]], best
+}
+
+// FindWord searches the index and returns all strings containing the word
+// as a whole word. An occurrence of the word must be bounded on each side by
+// a non-word character or by the start or end of the string. Word characters
+// are Unicode letters and digits.
+func (i *Index) FindWord(word string) []string {
+	word = i.strip(word)
+	if len(word) == 0 {
+		return []string{}
+	}
+
+	var s scratch
+	return i.search(word, &s, func(key string) bool {
+		return containsWord(key, word)
+	})
+}
+
+// FindFold searches the index and returns all strings containing the
+// substring under ASCII case folding. The index itself is case-sensitive, so
+// candidates are still narrowed down using the substring's n-grams exactly
+// as given. As a result, FindFold only finds strings in which each n-gram it
+// examines appears in the same case as in the substring. Only characters not
+// covered by an examined n-gram, such as the trailing characters skipped by
+// the SkipTail strategy, may differ in case. Searches that scan every
+// string, such as those for substrings shorter than an n-gram, find all
+// case-insensitive matches.
+func (i *Index) FindFold(substr string) []string {
+	substr = i.strip(substr)
+
+	var s scratch
+	return i.search(substr, &s, func(key string) bool {
+		return ContainsFold(key, substr)
+	})
+}
+
+// FindNoSpan searches the index and returns all strings containing the
+// substring within a single segment, where segments are separated by sep.
+// An occurrence of the substring that overlaps a separator doesn't count as
+// a match. If sep is empty, FindNoSpan behaves like Find.
+func (i *Index) FindNoSpan(substr, sep string) []string {
+	if len(sep) == 0 {
+		return i.Find(substr)
+	}
+
+	substr = i.strip(substr)
+
+	var s scratch
+	return i.search(substr, &s, func(key string) bool {
+		return containsNoSpan(key, substr, sep)
+	})
+}
+
+// TotalOccurrences returns the total number of times the substring occurs
+// across all strings in the index, including overlapping occurrences within
+// a single string. For example, "aa" occurs 3 times in "aaaa".
+func (i *Index) TotalOccurrences(substr string) int {
+	substr = i.strip(substr)
+	total := 0
+	if i.bruteForce(substr) {
+		for _, str := range i.strings {
+			total += occurrences(i.key(str), substr)
+		}
+		return total
+	}
+
+	var s scratch
+	if !i.filter(substr, &s) {
+		return 0
+	}
+	for str := range s.candidates {
+		total += occurrences(i.key(str), substr)
+	}
+	return total
+}
+
+// bruteForce returns true if a search for the substring should scan every
+// string directly. This is the case for substrings too short to contain an
+// n-gram and for indexes too small to benefit from n-gram filtering.
+func (i *Index) bruteForce(substr string) bool {
+	return len(substr) < n || len(i.strings) < i.bruteLimit
+}
+
+// bruteForceSearch performs a direct search through all strings, returning
+// those whose searchable forms are accepted by match. Used for short
+// substring searches and small indexes.
+func (i *Index) bruteForceSearch(match func(key string) bool) []string {
 	result := make([]string, 0)
 	for _, str := range i.strings {
-		if contains(str, substr) {
+		if match(i.key(str)) {
 			result = append(result, str)
 		}
 	}
 	return result
 }
 
+// Bucket returns a copy of the strings stored in the index under an n-gram's
+// hash. Because different n-grams may share a hash, not every string in the
+// bucket necessarily contains the n-gram. If the n-gram is too common to be
+// indexed, or no indexed string contains it, the bucket is empty. Bucket
+// returns nil if the n-gram isn't exactly n bytes long.
+func (i *Index) Bucket(ngram string) []string {
+	if len(ngram) != n {
+		return nil
+	}
+	return slices.Clone(i.getMatches(i.hash(ngram)))
+}
+
 // getMatches returns all strings associated with a hash.
 func (i *Index) getMatches(hash uint32) []string {
 	if strings, ok := i.table[hash]; ok {
@@ -127,32 +1284,246 @@ func (i *Index) getMatches(hash uint32) []string {
 	return []string{}
 }
 
+// FirstIndex returns the byte offset of the first occurrence of a substring
+// within a string, or -1 if the string doesn't contain the substring. An
+// empty substring occurs at offset 0.
+func FirstIndex(str, substr string) int {
+	ssn := len(substr)
+	if ssn > len(str) {
+		return -1
+	}
+
+	for k, s := 0, str; len(s) >= ssn; k, s = k+1, s[1:] {
+		if s[:ssn] == substr {
+			return k
+		}
+	}
+
+	return -1
+}
+
 // contains checks if a string contains a substring.
 func contains(str, substr string) bool {
+	return FirstIndex(str, substr) >= 0
+}
+
+// ContainsFold checks if a string contains a substring under ASCII case
+// folding, so that "HeLLo" contains "ell". Non-ASCII characters must match
+// exactly.
+func ContainsFold(str, substr string) bool {
 	ssn := len(substr)
 	if ssn > len(str) {
 		return false
 	}
 
 	for s := str; len(s) >= ssn; s = s[1:] {
-		if s[:ssn] == substr {
+		if equalFoldASCII(s[:ssn], substr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// equalFoldASCII checks if two strings of equal length are equal under ASCII
+// case folding.
+func equalFoldASCII(a, b string) bool {
+	for k := 0; k < len(a); k++ {
+		if lowerASCII(a[k]) != lowerASCII(b[k]) {
+			return false
+		}
+	}
+	return true
+}
+
+// lowerASCII converts an ASCII upper-case letter to lower case.
+func lowerASCII(c byte) byte {
+	if 'A' <= c && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
+
+// containsWord checks if a string contains a word bounded on each side by a
+// non-word character or by the start or end of the string.
+func containsWord(str, word string) bool {
+	for off := 0; off < len(str); {
+		k := FirstIndex(str[off:], word)
+		if k < 0 {
+			return false
+		}
+
+		start, end := off+k, off+k+len(word)
+		before, _ := utf8.DecodeLastRuneInString(str[:start])
+		after, _ := utf8.DecodeRuneInString(str[end:])
+		if (start == 0 || !isWordRune(before)) && (end == len(str) || !isWordRune(after)) {
 			return true
 		}
+		off = start + 1
 	}
+	return false
+}
 
+// containsNoSpan checks if a string contains a substring without the
+// substring overlapping any occurrence of a non-empty separator, including
+// occurrences of the separator that overlap one another.
+func containsNoSpan(str, substr, sep string) bool {
+	if !contains(str, sep) {
+		return contains(str, substr)
+	}
+
+	// Mark the start and end of every occurrence of the separator, scanning
+	// one byte at a time so that overlapping occurrences are all found.
+	depth := make([]int, len(str)+1)
+	for k := 0; k+len(sep) <= len(str); k++ {
+		if str[k:k+len(sep)] == sep {
+			depth[k]++
+			depth[k+len(sep)]--
+		}
+	}
+
+	// covered[k] is the number of bytes in str[:k] inside a separator.
+	covered := make([]int, len(str)+1)
+	d := 0
+	for k := 0; k < len(str); k++ {
+		d += depth[k]
+		covered[k+1] = covered[k]
+		if d > 0 {
+			covered[k+1]++
+		}
+	}
+
+	for k := 0; k+len(substr) <= len(str); k++ {
+		end := k + len(substr)
+		if str[k:end] == substr && covered[end] == covered[k] {
+			return true
+		}
+	}
 	return false
 }
 
-// hash computes a string's hash value. It uses an algorithm similar to the
-// one used by pre-6.0 .NET.
+// isWordRune checks if a rune is a word character.
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// occurrences counts the number of times a substring occurs within a
+// string, including overlapping occurrences.
+func occurrences(str, substr string) int {
+	count := 0
+	for k := 0; k+len(substr) <= len(str); k++ {
+		if str[k:k+len(substr)] == substr {
+			count++
+		}
+	}
+	return count
+}
+
+// Ngrams returns the overlapping n-grams of a string, in order. These are
+// the n-grams under which the index stores the string. A string shorter than
+// the n-gram length has no n-grams.
+func Ngrams(s string) []string {
+	return appendNgrams(make([]string, 0, max(len(s)-n+1, 0)), s)
+}
+
+// appendNgrams appends the overlapping n-grams of a string to dst and
+// returns the extended slice. The n-gram at index k of the result begins at
+// byte offset k of the string.
+func appendNgrams(dst []string, s string) []string {
+	eachNgram(s, func(_ int, ngram string) {
+		dst = append(dst, ngram)
+	})
+	return dst
+}
+
+// eachNgram calls fn with the byte offset and text of each overlapping
+// n-gram of a string, in order.
+func eachNgram(s string, fn func(k int, ngram string)) {
+	for k := 0; k+n <= len(s); k++ {
+		fn(k, s[k:k+n])
+	}
+}
+
+// hash computes the hash of an n-gram using the index's seed.
+func (i *Index) hash(ngram string) uint32 {
+	return i.hasher.hash(ngram)
+}
+
+// roll computes the hash of the next n-gram in a string using the index's
+// seed, given the hash of the current one.
+func (i *Index) roll(hash uint32, out, in byte) uint32 {
+	return i.hasher.roll(hash, out, in)
+}
+
+// hash computes a string's hash value using the default seed.
 func hash(str string) uint32 {
-	hash1, hash2 := prime0, prime0
-	for ; len(str) >= 2; str = str[2:] {
-		hash1 = ((hash1 << 5) + hash1) ^ uint32(str[0])
-		hash2 = ((hash2 << 5) + hash2) ^ uint32(str[1])
+	return defaultHasher.hash(str)
+}
+
+// roll computes the hash of the next n-gram in a string using the default
+// seed, given the hash of the current one.
+func roll(hash uint32, out, in byte) uint32 {
+	return defaultHasher.roll(hash, out, in)
+}
+
+// hasher computes polynomial hashes starting from a seed. The seed also
+// determines the polynomial's base, so hashers with different seeds group
+// n-grams into hashes differently, rather than merely offsetting every hash
+// by the same amount.
+type hasher struct {
+	seed   uint32 // initial hash state
+	base   uint32 // polynomial base
+	out    uint32 // weight of the first character in an n-gram's hash (base^(n-1))
+	weight uint32 // weight of the initial hash state in an n-gram's hash (base^n)
+}
+
+// defaultHasher hashes with the default seed, prime0, and base, prime1.
+var defaultHasher = newHasher(prime0)
+
+// newHasher creates a hasher for the seed. The base is prime1 with its bits
+// flipped according to a mix of the seed's difference from prime0, so the
+// default seed keeps prime1 as its base. The base is kept odd so that it
+// doesn't shift characters out of the hash.
+func newHasher(seed uint32) hasher {
+	base := (prime1 ^ mix(seed^prime0)) | 1
+	return hasher{seed: seed, base: base, out: pow(base, n-1), weight: pow(base, n)}
+}
+
+// hash computes a string's hash value. It is a polynomial hash, which allows
+// the hash of each n-gram in a string to be derived from the hash of the
+// previous one using roll.
+func (h *hasher) hash(str string) uint32 {
+	hash := h.seed
+	for i := 0; i < len(str); i++ {
+		hash = hash*h.base + uint32(str[i])
 	}
-	if len(str) > 0 {
-		hash1 = ((hash1 << 5) + hash1) ^ uint32(str[0])
+	return hash
+}
+
+// roll computes the hash of the next n-gram in a string given the hash of
+// the current one. The character out leaves the front of the window, and the
+// character in enters at the back.
+func (h *hasher) roll(hash uint32, out, in byte) uint32 {
+	s := h.seed * h.weight
+	return (hash-s-h.out*uint32(out))*h.base + s + uint32(in)
+}
+
+// mix scrambles the bits of x, mapping zero to zero. It is the finalizer of
+// the MurmurHash3 hash function.
+func mix(x uint32) uint32 {
+	x ^= x >> 16
+	x *= 0x85ebca6b
+	x ^= x >> 13
+	x *= 0xc2b2ae35
+	x ^= x >> 16
+	return x
+}
+
+// pow computes x^y, wrapping on overflow.
+func pow(x uint32, y int) uint32 {
+	p := uint32(1)
+	for ; y > 0; y-- {
+		p *= x
 	}
-	return hash1 + (hash2 * prime1)
+	return p
 }
@@ -1,9 +1,18 @@
 package rkindex
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
 	"reflect"
+	"slices"
 	"sort"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
+	"unsafe"
 )
 
 func TestNewIndex(t *testing.T) {
@@ -29,170 +38,1398 @@ func TestNewIndex(t *testing.T) {
 	}
 }
 
+func TestNewIndexSized(t *testing.T) {
+	for _, buckets := range []int{-1, 0, 10, 100000} {
+		idx := NewIndexSized(smallCorpus(), buckets)
+		expected := NewIndex(smallCorpus())
+		if !reflect.DeepEqual(idx.strings, expected.strings) || !reflect.DeepEqual(idx.table, expected.table) {
+			t.Errorf("NewIndexSized(%d) built a different index than NewIndex", buckets)
+		}
+	}
+}
+
+func TestNewIndexDuplicates(t *testing.T) {
+	idx := NewIndex([]string{"world", "hello", "world", "hello world", "hello"})
+
+	expected := []string{"world", "hello", "hello world"}
+	if !reflect.DeepEqual(idx.strings, expected) {
+		t.Errorf("Expected strings %v, got %v", expected, idx.strings)
+	}
+
+	result := idx.Find("hello")
+	sort.Strings(result)
+	if !reflect.DeepEqual(result, []string{"hello", "hello world"}) {
+		t.Errorf("Expected each match once, got %v", result)
+	}
+}
+
+func TestFindDuplicates(t *testing.T) {
+	for _, limit := range []int{defaultBruteForceLimit, 0} {
+		idx := NewIndex([]string{"a", "a", "ab", "abc", "abc"})
+		idx.SetBruteForceLimit(limit)
+
+		cases := []struct {
+			substring string
+			expected  []string
+		}{
+			{"", []string{"a", "ab", "abc"}},
+			{"a", []string{"a", "ab", "abc"}},
+			{"ab", []string{"ab", "abc"}},
+			{"abc", []string{"abc"}},
+		}
+		for _, c := range cases {
+			result := idx.Find(c.substring)
+			sort.Strings(result)
+			if !reflect.DeepEqual(result, c.expected) {
+				t.Errorf("Find(%q): expected %v, got %v", c.substring, c.expected, result)
+			}
+
+			streamed := []string{}
+			for str := range idx.FindChan(context.Background(), c.substring) {
+				streamed = append(streamed, str)
+			}
+			sort.Strings(streamed)
+			if !reflect.DeepEqual(streamed, c.expected) {
+				t.Errorf("FindChan(%q): expected %v, got %v", c.substring, c.expected, streamed)
+			}
+		}
+
+		if got := idx.FindWord("a"); !reflect.DeepEqual(got, []string{"a"}) {
+			t.Errorf("FindWord(%q): expected [a], got %v", "a", got)
+		}
+		if got := idx.TotalOccurrences("a"); got != 3 {
+			t.Errorf("TotalOccurrences(%q): expected 3, got %d", "a", got)
+		}
+	}
+}
+
+func TestNewIndexIgnoring(t *testing.T) {
+	testStrings := []string{
+		"555-1234", "(555) 1234", "555 9876", "1-800-555-1234", "5551234", "12-34",
+	}
+
+	cases := []struct {
+		substring string
+		expected  []string
+	}{
+		{"5551234", []string{"555-1234", "(555) 1234", "1-800-555-1234", "5551234"}},
+		{"555-1234", []string{"555-1234", "(555) 1234", "1-800-555-1234", "5551234"}},
+		{"(555)", []string{"555-1234", "(555) 1234", "555 9876", "1-800-555-1234", "5551234"}},
+		{"1234", []string{"555-1234", "(555) 1234", "1-800-555-1234", "5551234", "12-34"}},
+		{"80055", []string{"1-800-555-1234"}},
+		{"5559876", []string{"555 9876"}},
+		{"55512345", []string{}},
+	}
+
+	for _, limit := range []int{defaultBruteForceLimit, 0} {
+		idx := NewIndexIgnoring(testStrings, "-() ")
+		idx.SetBruteForceLimit(limit)
+		for _, c := range cases {
+			result := idx.Find(c.substring)
+			sort.Strings(result)
+			sort.Strings(c.expected)
+			if !reflect.DeepEqual(result, c.expected) {
+				t.Errorf("Find(%q): expected %v, got %v", c.substring, c.expected, result)
+			}
+
+			streamed := []string{}
+			for str := range idx.FindChan(context.Background(), c.substring) {
+				streamed = append(streamed, str)
+			}
+			sort.Strings(streamed)
+			if !reflect.DeepEqual(streamed, c.expected) {
+				t.Errorf("FindChan(%q): expected %v, got %v", c.substring, c.expected, streamed)
+			}
+
+			if got := idx.MayContain(c.substring); got != (len(c.expected) > 0) {
+				t.Errorf("MayContain(%q): expected %v, got %v", c.substring, len(c.expected) > 0, got)
+			}
+		}
+
+		if got := idx.TotalOccurrences("555"); got != 5 {
+			t.Errorf("TotalOccurrences(%q): expected 5, got %d", "555", got)
+		}
+	}
+
+	// Searches of ignored characters alone match everything.
+	idx := NewIndexIgnoring(testStrings, "-() ")
+	if got := idx.Find("--"); len(got) != len(testStrings) {
+		t.Errorf("Expected all strings for ignored-only query, got %v", got)
+	}
+}
+
+func TestNewIndexIgnoringInvalidUTF8(t *testing.T) {
+	testStrings := []string{"ab\xfecd", "plain", "x-\xff-y", "rock\uFFFDroll"}
+
+	cases := []struct {
+		substring string
+		expected  []string
+	}{
+		// Invalid bytes are matched as themselves, never as U+FFFD.
+		{"\xff", []string{"x-\xff-y"}},
+		{"\xfe", []string{"ab\xfecd"}},
+		{"\uFFFD", []string{"rock\uFFFDroll"}},
+		{"b\xfec", []string{"ab\xfecd"}},
+		{"x\xffy", []string{"x-\xff-y"}},
+		{"x-\xff", []string{"x-\xff-y"}},
+		{"k\uFFFDr", []string{"rock\uFFFDroll"}},
+		{"b\uFFFDc", []string{}},
+	}
+
+	for _, limit := range []int{defaultBruteForceLimit, 0} {
+		idx := NewIndexIgnoring(testStrings, "-")
+		idx.SetBruteForceLimit(limit)
+		plain := NewIndex(testStrings)
+		for _, c := range cases {
+			result := idx.Find(c.substring)
+			sort.Strings(result)
+			sort.Strings(c.expected)
+			if !reflect.DeepEqual(result, c.expected) {
+				t.Errorf("Find(%q): expected %q, got %q", c.substring, c.expected, result)
+			}
+		}
+
+		// Without any ignored characters in play, the results match those of
+		// an index that ignores nothing.
+		for _, substr := range []string{"\xff", "\xfe", "\uFFFD", "b\xfec"} {
+			result := idx.Find(substr)
+			expected := plain.Find(substr)
+			sort.Strings(result)
+			sort.Strings(expected)
+			if !reflect.DeepEqual(result, expected) {
+				t.Errorf("Find(%q): expected %q, got %q", substr, expected, result)
+			}
+		}
+	}
+
+	idx := NewIndexIgnoring(nil, "-")
+	if str := "a\xffb"; idx.strip(str) != str {
+		t.Errorf("Expected strip to keep invalid bytes, got %q", idx.strip(str))
+	}
+	if got := idx.strip("a-\xff-b"); got != "a\xffb" {
+		t.Errorf("Expected %q, got %q", "a\xffb", got)
+	}
+}
+
+// duplicateStrings returns many separately allocated copies of a few
+// distinct strings.
+func duplicateStrings() []string {
+	strs := make([]string, 10000)
+	for i := range strs {
+		strs[i] = strings.Repeat(strconv.Itoa(i%100), 10)
+	}
+	return strs
+}
+
+func TestNewIndexInterning(t *testing.T) {
+	input := duplicateStrings()
+	idx := NewIndex(input)
+
+	if len(idx.strings) != 100 {
+		t.Fatalf("Expected 100 distinct strings, got %d", len(idx.strings))
+	}
+	if cap(idx.strings) != len(idx.strings) {
+		t.Errorf("Expected strings sized for distinct strings, got capacity %d", cap(idx.strings))
+	}
+
+	// Every reference to a string must share the data of its first
+	// appearance in the input.
+	canonical := map[string]*byte{}
+	for k, str := range input[:100] {
+		canonical[str] = unsafe.StringData(input[k])
+	}
+	for _, str := range idx.strings {
+		if unsafe.StringData(str) != canonical[str] {
+			t.Errorf("String %q isn't interned", str)
+		}
+	}
+	for _, bucket := range idx.table {
+		for _, str := range bucket {
+			if unsafe.StringData(str) != canonical[str] {
+				t.Errorf("Bucket entry %q isn't interned", str)
+			}
+		}
+	}
+}
+
+func TestNewIndexFromKeys(t *testing.T) {
+	type record struct{ id int }
+	m := map[string]record{
+		"hello world":   {1},
+		"world of code": {2},
+		"hello code":    {3},
+	}
+	idx := NewIndexFromKeys(m)
+
+	all := slices.Clone(idx.strings)
+	sort.Strings(all)
+	if !reflect.DeepEqual(all, []string{"hello code", "hello world", "world of code"}) {
+		t.Errorf("Expected the map's keys to be indexed, got %v", all)
+	}
+
+	ids := []int{}
+	for _, str := range idx.Find("world") {
+		ids = append(ids, m[str].id)
+	}
+	sort.Ints(ids)
+	if !reflect.DeepEqual(ids, []int{1, 2}) {
+		t.Errorf("Expected records 1 and 2, got %v", ids)
+	}
+}
+
 func makeString(len int) string {
 	runes := make([]rune, len)
 	for i := 0; i < len; i++ {
 		runes[i] = 'a'
 	}
-	return string(runes)
+	return string(runes)
+}
+
+func TestAddToIndex(t *testing.T) {
+	idx := &Index{
+		table:   make(map[uint32][]string),
+		strings: []string{},
+	}
+
+	// Test adding a string for a new hash
+	hash1 := uint32(12345)
+	str1 := "test1"
+	idx.appendHash(hash1, str1)
+
+	if strings, exists := idx.table[hash1]; !exists || len(strings) != 1 || strings[0] != str1 {
+		t.Errorf("Expected new hash entry with string %s, got %v", str1, strings)
+	}
+
+	// Test adding a different string with the same hash
+	str2 := "test2"
+	idx.appendHash(hash1, str2)
+
+	if strings, exists := idx.table[hash1]; !exists || len(strings) != 2 ||
+		strings[0] != str1 || strings[1] != str2 {
+		t.Errorf("Expected hash entry with strings %s and %s, got %v", str1, str2, strings)
+	}
+
+	// Test adding the bucket's last string again (should not add duplicate)
+	idx.appendHash(hash1, str2)
+
+	if strings, exists := idx.table[hash1]; !exists || len(strings) != 2 {
+		t.Errorf("Expected hash entry to still have 2 strings, got %v", strings)
+	}
+
+	// Only the last string is checked, so an earlier string is added again.
+	// Builds never do this, because all of a string's n-grams are added
+	// before those of the next string.
+	idx.appendHash(hash1, str1)
+
+	if strings := idx.table[hash1]; len(strings) != 3 || strings[2] != str1 {
+		t.Errorf("Expected earlier string to be appended again, got %v", strings)
+	}
+}
+
+var findCases = []struct {
+	name      string
+	strings   []string
+	substring string
+	expected  []string
+}{
+	{
+		name:      "No matches (short)",
+		strings:   []string{"hello", "world", "hi there"},
+		substring: "x",
+		expected:  []string{},
+	},
+	{
+		name:      "No matches",
+		strings:   []string{"hello", "world", "hi there"},
+		substring: "xyzxyzxyz",
+		expected:  []string{},
+	},
+	{
+		name:      "Empty index",
+		strings:   []string{},
+		substring: "test",
+		expected:  []string{},
+	},
+	{
+		name:      "Substring shorter than n-gram size",
+		strings:   []string{"hello", "world", "hi there"},
+		substring: "hi",
+		expected:  []string{"hi there"},
+	},
+	{
+		name:      "All matches",
+		strings:   []string{"hello", "world", "hi there"},
+		substring: "",
+		expected:  []string{"hello", "world", "hi there"},
+	},
+	{
+		name:      "Multiple matches",
+		strings:   []string{"hello world", "world of code", "hello code"},
+		substring: "world",
+		expected:  []string{"hello world", "world of code"},
+	},
+	{
+		name:      "Substring exactly n-gram size",
+		strings:   []string{"abcdef", "xyzabc", "abcxyz"},
+		substring: string(make([]byte, n)),
+		expected:  []string{},
+	},
+	{
+		name:      "Substring longer than n-gram size",
+		strings:   []string{"hello world", "world hello", "hello there world"},
+		substring: "hello world",
+		expected:  []string{"hello world"},
+	},
+	{
+		name:      "Partial word match",
+		strings:   []string{"testing", "est", "test"},
+		substring: "tes",
+		expected:  []string{"testing", "test"},
+	},
+	{
+		name:      "Partial word match",
+		strings:   []string{"testing", "est", "test"},
+		substring: "est",
+		expected:  []string{"testing", "est", "test"},
+	},
+	{
+		name:      "Partial word match",
+		strings:   []string{"testing", "est", "test"},
+		substring: "sti",
+		expected:  []string{"testing"},
+	},
+	{
+		name:      "Partial word match",
+		strings:   []string{"testing", "est", "test"},
+		substring: "tin",
+		expected:  []string{"testing"},
+	},
+	{
+		name:      "Partial word match",
+		strings:   []string{"testing", "est", "test"},
+		substring: "ing",
+		expected:  []string{"testing"},
+	},
+	{
+		name:      "Multiple n-gram matches that fail",
+		strings:   []string{"abcde", "defg"},
+		substring: "abcdef",
+		expected:  []string{},
+	},
+	{
+		name:      "Case sensitivity",
+		strings:   []string{"Hello", "HELLO", "hello"},
+		substring: "hello",
+		expected:  []string{"hello"},
+	},
+	{
+		name:      "Noncontiguous n-grams",
+		strings:   []string{"abcXdefXghi", "XabcXdefX", "defabc"},
+		substring: "abcdef",
+		expected:  []string{},
+	},
+	{
+		name:      "Noncontiguous n-grams",
+		strings:   []string{"xabcdef"},
+		substring: "defxabc",
+		expected:  []string{},
+	},
+}
+
+func TestFind(t *testing.T) {
+	for _, c := range findCases {
+		t.Run(c.name, func(t *testing.T) {
+			// Test both the brute force and indexed search paths
+			for _, limit := range []int{defaultBruteForceLimit, 0} {
+				idx := NewIndex(c.strings)
+				idx.SetBruteForceLimit(limit)
+				result := idx.Find(c.substring)
+
+				// Sort both slices for consistent comparison
+				sort.Strings(result)
+				sort.Strings(c.expected)
+
+				if !reflect.DeepEqual(result, c.expected) {
+					t.Errorf("Brute force limit %d: expected %v, got %v", limit, c.expected, result)
+				}
+			}
+		})
+	}
+}
+
+// finder is implemented by every kind of index that can be searched.
+type finder interface {
+	Find(substr string) []string
+}
+
+// findFunc adapts a search function to the finder interface.
+type findFunc func(substr string) []string
+
+func (f findFunc) Find(substr string) []string {
+	return f(substr)
+}
+
+// sameResultQueries are the substrings searched by checkSameResults. Against
+// smallCorpus, they cover short substrings, matches, misses and substrings
+// whose n-grams appear only noncontiguously.
+var sameResultQueries = []string{
+	"", "x", "he", "hello", "world", "hello world", "abcdef", "the", "dolor",
+	"xyzxyz", "test", "5551234",
+}
+
+// checkSameResults checks that got and want return the same matches, in any
+// order, for each of sameResultQueries. Errors are prefixed with name.
+func checkSameResults(t *testing.T, name string, got, want finder) {
+	t.Helper()
+	for _, substr := range sameResultQueries {
+		result := got.Find(substr)
+		expected := want.Find(substr)
+		sort.Strings(result)
+		sort.Strings(expected)
+		if !reflect.DeepEqual(result, expected) {
+			t.Errorf("%s: Find(%q): expected %v, got %v", name, substr, expected, result)
+		}
+	}
+}
+
+func smallCorpus() []string {
+	return []string{
+		"hello world", "goodbye world", "hello there", "general kenobi",
+		"lorem ipsum dolor sit amet", "world of code", "hello code",
+		"the quick brown fox", "jumps over the lazy dog", "testing",
+		"est", "test", "abcXdefXghi", "XabcXdefX", "defabc", "xabcdef",
+		"consectetur adipiscing elit", "sed do eiusmod tempor", "incididunt",
+		"ut labore et dolore magna aliqua",
+	}
+}
+
+func TestBruteForceLimit(t *testing.T) {
+	indexed := NewIndex(smallCorpus())
+	indexed.SetBruteForceLimit(0)
+	brute := NewIndex(smallCorpus())
+	brute.SetBruteForceLimit(len(smallCorpus()) + 1)
+
+	if e := NewIndex(smallCorpus()[:defaultBruteForceLimit-1]).Explain("hello"); !e.BruteForce {
+		t.Error("Expected a small index to use brute force by default")
+	}
+	if e := brute.Explain("hello"); !e.BruteForce {
+		t.Error("Expected an index below its limit to use brute force")
+	}
+	if e := indexed.Explain("hello"); e.BruteForce {
+		t.Error("Expected an index without a limit to use n-grams")
+	}
+
+	checkSameResults(t, "Brute force", brute, indexed)
+}
+
+func TestMayContain(t *testing.T) {
+	// MayContain must never report a false negative.
+	for _, c := range findCases {
+		for _, limit := range []int{defaultBruteForceLimit, 0} {
+			idx := NewIndex(c.strings)
+			idx.SetBruteForceLimit(limit)
+			if len(c.expected) > 0 && !idx.MayContain(c.substring) {
+				t.Errorf("%s: MayContain(%q) reported a false negative", c.name, c.substring)
+			}
+		}
+	}
+
+	idx := NewIndex([]string{"abcXdefXghi", "XabcXdefX", "defabc"})
+	idx.SetBruteForceLimit(0)
+
+	// Noncontiguous n-grams produce a false positive.
+	if !idx.MayContain("abcdef") || len(idx.Find("abcdef")) != 0 {
+		t.Errorf("Expected a false positive for noncontiguous n-grams")
+	}
+	if idx.MayContain("abcxyz") || idx.MayContain("zz") {
+		t.Errorf("Expected missing n-grams to rule out a match")
+	}
+	if !idx.MayContain("ab") || !idx.MayContain("") {
+		t.Errorf("Expected short substrings to be found")
+	}
+	if NewIndex([]string{}).MayContain("") {
+		t.Errorf("Expected empty index to contain nothing")
+	}
+}
+
+func TestFindNotContaining(t *testing.T) {
+	testStrings := []string{
+		"hello world", "world of code", "hello code", "testing", "est", "test",
+	}
+	idx := NewIndex(testStrings)
+
+	for _, substr := range []string{"", "x", "es", "world", "code", "test", "xyzxyz"} {
+		found := idx.Find(substr)
+		notFound := idx.FindNotContaining(substr)
+
+		for _, str := range notFound {
+			if contains(str, substr) {
+				t.Errorf("FindNotContaining(%q): %q contains the substring", substr, str)
+			}
+		}
+
+		// Find and FindNotContaining should partition the index's strings.
+		all := append(slices.Clone(found), notFound...)
+		sort.Strings(all)
+		expected := slices.Clone(testStrings)
+		sort.Strings(expected)
+		if !reflect.DeepEqual(all, expected) {
+			t.Errorf("Find(%q) and FindNotContaining(%q) don't partition the index: %v and %v",
+				substr, substr, found, notFound)
+		}
+	}
+
+	if result := idx.FindNotContaining(""); len(result) != 0 {
+		t.Errorf("Expected no strings for empty substring, got %v", result)
+	}
+}
+
+func TestBuildTable(t *testing.T) {
+	// Building with appendHash must produce the same table as checking every
+	// bucket for duplicates with appendHashUnique.
+	corpora := [][]string{
+		smallCorpus(),
+		longStrings(),
+		worstCaseStrings()[:50],
+		{"aaaaa", "aaa", "abababab", "ab", ""},
+	}
+	for _, corpus := range corpora {
+		idx := NewIndex(corpus)
+		expected := newIndexNoRoll(idx.strings)
+		if !reflect.DeepEqual(idx.table, expected.table) {
+			t.Errorf("Build of %d strings produced a different table", len(corpus))
+		}
+	}
+}
+
+func TestFindBatch(t *testing.T) {
+	idx := NewIndex([]string{
+		"hello world", "world of code", "hello code", "testing", "est", "test",
+		"abcXdefXghi", "XabcXdefX", "defabc",
+	})
+
+	substrs := []string{
+		"world", "", "x", "code", "xyzxyz", "test", "abcdef", "hello", "es", "def",
+	}
+	results := idx.FindBatch(substrs)
+	if len(results) != len(substrs) {
+		t.Fatalf("Expected %d results, got %d", len(substrs), len(results))
+	}
+
+	for k, substr := range substrs {
+		result := slices.Clone(results[k])
+		expected := idx.Find(substr)
+		sort.Strings(result)
+		sort.Strings(expected)
+		if !reflect.DeepEqual(result, expected) {
+			t.Errorf("FindBatch result %d (%q): expected %v, got %v", k, substr, expected, result)
+		}
+	}
+}
+
+func TestFindBudget(t *testing.T) {
+	idx := NewIndex(smallCorpus())
+	idx.SetBruteForceLimit(0)
+
+	// "hello" narrows the candidates to 3 strings, all of which match.
+	result, err := idx.FindBudget("hello", 3)
+	if err != nil {
+		t.Fatalf("Expected no error under budget, got %v", err)
+	}
+	sort.Strings(result)
+	expected := []string{"hello code", "hello there", "hello world"}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+
+	if _, err := idx.FindBudget("hello", 2); err != ErrTooBroad {
+		t.Errorf("Expected ErrTooBroad over budget, got %v", err)
+	}
+
+	// "abcdef" leaves 4 candidates, only one of which matches. The budget
+	// applies to candidates rather than matches.
+	if _, err := idx.FindBudget("abcdef", 3); err != ErrTooBroad {
+		t.Errorf("Expected ErrTooBroad for candidates over budget, got %v", err)
+	}
+	if result, err := idx.FindBudget("abcdef", 4); err != nil || len(result) != 1 {
+		t.Errorf("Expected 1 match under budget, got %v, %v", result, err)
+	}
+
+	// Short substrings make every string a candidate.
+	if _, err := idx.FindBudget("he", len(idx.strings)-1); err != ErrTooBroad {
+		t.Errorf("Expected ErrTooBroad for short substring, got %v", err)
+	}
+	if result, err := idx.FindBudget("he", len(idx.strings)); err != nil || len(result) != 5 {
+		t.Errorf("Expected 5 matches for short substring, got %v, %v", result, err)
+	}
+
+	// A substring with no candidates is never too broad.
+	if result, err := idx.FindBudget("xyzxyz", 0); err != nil || len(result) != 0 {
+		t.Errorf("Expected no matches and no error, got %v, %v", result, err)
+	}
+
+	// Neither is a substring longer than every string, even if it's short
+	// enough to be searched by scanning every string.
+	idx.SetBruteForceLimit(defaultBruteForceLimit * 10)
+	if result, err := idx.FindBudget(strings.Repeat("hello ", 10), 0); err != nil || len(result) != 0 {
+		t.Errorf("Expected no matches and no error for over-long substring, got %v, %v", result, err)
+	}
+}
+
+func TestFindDetailed(t *testing.T) {
+	idx := NewIndex([]string{"abcXdefXghi", "XabcXdefX", "defabc", "xabcdef", "hello"})
+	idx.SetBruteForceLimit(0)
+
+	cases := []struct {
+		substring  string
+		matches    []string
+		candidates int
+	}{
+		// Every string containing both n-grams is a candidate, but only one
+		// contains them contiguously.
+		{"abcdef", []string{"xabcdef"}, 4},
+		{"hello", []string{"hello"}, 1},
+		{"xyz", []string{}, 0},
+		{"ab", []string{"abcXdefXghi", "XabcXdefX", "defabc", "xabcdef"}, 5},
+
+		// No string is long enough to be a candidate.
+		{"abcXdefXghiX", []string{}, 0},
+	}
+	for _, c := range cases {
+		matches, candidates := idx.FindDetailed(c.substring)
+		sort.Strings(matches)
+		sort.Strings(c.matches)
+		if !reflect.DeepEqual(matches, c.matches) {
+			t.Errorf("FindDetailed(%q): expected matches %v, got %v", c.substring, c.matches, matches)
+		}
+		if candidates != c.candidates {
+			t.Errorf("FindDetailed(%q): expected %d candidates, got %d", c.substring, c.candidates, candidates)
+		}
+		if candidates < len(matches) {
+			t.Errorf("FindDetailed(%q): fewer candidates than matches", c.substring)
+		}
+	}
+}
+
+func TestFindWithIndices(t *testing.T) {
+	input := []string{
+		"hello world", "xyz", "world of code", "hello world", "code", "world",
+	}
+
+	for _, limit := range []int{defaultBruteForceLimit, 0} {
+		idx := NewIndex(input)
+		idx.SetBruteForceLimit(limit)
+
+		cases := []struct {
+			substring string
+			expected  []IndexedMatch
+		}{
+			{"world", []IndexedMatch{{0, "hello world"}, {2, "world of code"}, {5, "world"}}},
+			{"code", []IndexedMatch{{2, "world of code"}, {4, "code"}}},
+			{"xy", []IndexedMatch{{1, "xyz"}}},
+			{"abc", []IndexedMatch{}},
+		}
+		for _, c := range cases {
+			result := idx.FindWithIndices(c.substring)
+			if !reflect.DeepEqual(result, c.expected) {
+				t.Errorf("FindWithIndices(%q): expected %v, got %v", c.substring, c.expected, result)
+			}
+			for _, m := range result {
+				if input[m.Index] != m.String {
+					t.Errorf("FindWithIndices(%q): %q is not at position %d", c.substring, m.String, m.Index)
+				}
+			}
+		}
+	}
+}
+
+func TestNewIndexMemBounded(t *testing.T) {
+	full := NewIndex(smallCorpus())
+	total := 0
+	for _, bucket := range full.table {
+		total += len(bucket)
+	}
+
+	refs := func(idx *Index) int {
+		count := 0
+		for _, bucket := range idx.table {
+			count += len(bucket)
+		}
+		return count
+	}
+
+	for _, budget := range []int{total, total / 2, 10, 1} {
+		// Build the index one n-gram at a time, checking the budget after
+		// every addition.
+		idx := newIndex(smallCorpus())
+		idx.budget = newRefBudget(budget)
+		for _, str := range idx.strings {
+			for _, ngram := range Ngrams(str) {
+				largest := 0
+				for _, bucket := range idx.table {
+					largest = max(largest, len(bucket))
+				}
+				sizes := make(map[uint32]int, len(idx.table))
+				for hash, bucket := range idx.table {
+					sizes[hash] = len(bucket)
+				}
+
+				idx.appendHash(hash(ngram), str)
+
+				if count := refs(idx); count > budget || count != idx.budget.total {
+					t.Fatalf("Budget %d: %d bucket references, %d tracked", budget, count, idx.budget.total)
+				}
+				for hash, size := range sizes {
+					if idx.common[hash] && size != largest {
+						t.Fatalf("Budget %d: discarded bucket of size %d while the largest held %d", budget, size, largest)
+					}
+				}
+			}
+		}
+
+		built := NewIndexMemBounded(smallCorpus(), budget)
+		if !reflect.DeepEqual(built.table, idx.table) || !reflect.DeepEqual(built.common, idx.common) {
+			t.Errorf("Budget %d: expected NewIndexMemBounded to build the same index", budget)
+		}
+		if built.budget != nil {
+			t.Errorf("Budget %d: expected budget to be released after the build", budget)
+		}
+		if budget < total && len(built.common) == 0 {
+			t.Errorf("Budget %d: expected discarded buckets", budget)
+		}
+		if budget >= total && len(built.common) != 0 {
+			t.Errorf("Budget %d: expected no discarded buckets, got %d", budget, len(built.common))
+		}
+	}
+
+	for _, budget := range []int{0, total, total / 2, 10, 1} {
+		idx := NewIndexMemBounded(smallCorpus(), budget)
+		if budget > 0 && refs(idx) > budget {
+			t.Errorf("Budget %d: expected at most %d bucket references, got %d", budget, budget, refs(idx))
+		}
+
+		for _, limit := range []int{defaultBruteForceLimit, 0} {
+			idx.SetBruteForceLimit(limit)
+			full.SetBruteForceLimit(limit)
+			checkSameResults(t, fmt.Sprintf("Budget %d", budget), idx, full)
+		}
+	}
+}
+
+func TestNewIndexStrict(t *testing.T) {
+	testStrings := []string{
+		"hello world", "bad \xff world", "héllo wörld", "\xc3", "world of code", "hello \xed\xa0\x80",
+	}
+
+	_, err := NewIndexStrict(testStrings, false)
+	var invalid *InvalidUTF8Error
+	if !errors.As(err, &invalid) {
+		t.Fatalf("Expected *InvalidUTF8Error, got %v", err)
+	}
+	if expected := []int{1, 3, 5}; !reflect.DeepEqual(invalid.Indices, expected) {
+		t.Errorf("Expected invalid indices %v, got %v", expected, invalid.Indices)
+	}
+
+	idx, err := NewIndexStrict(testStrings, true)
+	if err != nil {
+		t.Fatalf("Expected no error when skipping invalid strings, got %v", err)
+	}
+	expected := []string{"hello world", "héllo wörld", "world of code"}
+	if !reflect.DeepEqual(idx.strings, expected) {
+		t.Errorf("Expected strings %v, got %v", expected, idx.strings)
+	}
+
+	// The remaining strings keep their positions in the input.
+	matches := idx.FindWithIndices("world")
+	expectedMatches := []IndexedMatch{{0, "hello world"}, {4, "world of code"}}
+	if !reflect.DeepEqual(matches, expectedMatches) {
+		t.Errorf("Expected %v, got %v", expectedMatches, matches)
+	}
+
+	idx, err = NewIndexStrict(expected, false)
+	if err != nil {
+		t.Fatalf("Expected no error for valid strings, got %v", err)
+	}
+	if result := idx.Find("llo"); len(result) != 2 {
+		t.Errorf("Expected 2 matches, got %v", result)
+	}
+}
+
+func TestFindEmpty(t *testing.T) {
+	testStrings := []string{"hello world", "hello  world", "a   b", "   ", "tab\there", "x"}
+	idx := NewIndex(testStrings)
+
+	// Modifying the result of an empty search must not affect the index.
+	result := idx.Find("")
+	if !reflect.DeepEqual(result, testStrings) {
+		t.Fatalf("Expected %v, got %v", testStrings, result)
+	}
+	result[0] = "corrupted"
+	_ = append(result[:1], "corrupted")
+	if !reflect.DeepEqual(idx.strings, testStrings) {
+		t.Errorf("Expected index strings %v to be unaffected, got %v", testStrings, idx.strings)
+	}
+	if got := idx.Find("hello"); len(got) != 2 {
+		t.Errorf("Expected 2 matches after modifying result, got %v", got)
+	}
+
+	// Whitespace is matched like any other character.
+	cases := map[string][]string{
+		" ":    {"   ", "a   b", "hello  world", "hello world"},
+		"  ":   {"   ", "a   b", "hello  world"},
+		"   ":  {"   ", "a   b"},
+		"    ": {},
+		"\t":   {"tab\there"},
+		" \t":  {},
+	}
+	for _, limit := range []int{defaultBruteForceLimit, 0} {
+		idx.SetBruteForceLimit(limit)
+		for substr, expected := range cases {
+			result := idx.Find(substr)
+			sort.Strings(result)
+			if !reflect.DeepEqual(result, expected) {
+				t.Errorf("Find(%q): expected %v, got %v", substr, expected, result)
+			}
+		}
+	}
+}
+
+func TestFindOverlong(t *testing.T) {
+	idx := NewIndexIgnoring([]string{"hello", "he-l-l-o", "world"}, "-")
+	if idx.maxLen != 5 {
+		t.Errorf("Expected longest searchable string of length 5, got %d", idx.maxLen)
+	}
+
+	for _, limit := range []int{defaultBruteForceLimit, 0} {
+		idx.SetBruteForceLimit(limit)
+		if got := idx.Find("hello!"); len(got) != 0 {
+			t.Errorf("Expected no matches for over-long query, got %v", got)
+		}
+		result := idx.Find("hel-lo")
+		sort.Strings(result)
+		if expected := []string{"he-l-l-o", "hello"}; !reflect.DeepEqual(result, expected) {
+			t.Errorf("Expected %v, got %v", expected, result)
+		}
+	}
+}
+
+func TestFindLenRange(t *testing.T) {
+	testStrings := []string{"log", "log a", "log ab", "log abc", "log abcd", "catalog"}
+	idx := NewIndex(testStrings)
+
+	cases := []struct {
+		substring      string
+		minLen, maxLen int
+		expected       []string
+	}{
+		{"log", 5, 7, []string{"catalog", "log a", "log ab", "log abc"}},
+		{"log", 6, 6, []string{"log ab"}},
+		{"log", 0, 3, []string{"log"}},
+		{"log", 8, 0, []string{"log abcd"}},
+		{"log", 7, -1, []string{"catalog", "log abc", "log abcd"}},
+		{"log", 9, 0, []string{}},
+		{"log", 6, 5, []string{}},
+		{"ab", 6, 7, []string{"log ab", "log abc"}},
+		{"", 7, 7, []string{"catalog", "log abc"}},
+		{"xyz", 0, 0, []string{}},
+	}
+	for _, limit := range []int{defaultBruteForceLimit, 0} {
+		idx.SetBruteForceLimit(limit)
+		for _, c := range cases {
+			result := idx.FindLenRange(c.substring, c.minLen, c.maxLen)
+			sort.Strings(result)
+			if !reflect.DeepEqual(result, c.expected) {
+				t.Errorf("FindLenRange(%q, %d, %d): expected %v, got %v",
+					c.substring, c.minLen, c.maxLen, c.expected, result)
+			}
+		}
+	}
+}
+
+func TestFindUnverified(t *testing.T) {
+	idx := NewIndex(smallCorpus())
+
+	cases := []struct {
+		substring string
+		expected  []string
+	}{
+		// The n-grams of these substrings all appear in the returned
+		// strings, but not contiguously.
+		{"abcdefghi", []string{"abcXdefXghi"}},
+		{"abcdef", []string{"XabcXdefX", "abcXdefXghi", "defabc", "xabcdef"}},
+
+		// Otherwise, the results are the same as those of Find.
+		{"hello", []string{"hello code", "hello there", "hello world"}},
+		{"xyzxyz", []string{}},
+		{"he", []string{"hello code", "hello there", "hello world", "the quick brown fox", "jumps over the lazy dog"}},
+	}
+	for _, c := range cases {
+		result := idx.FindUnverified(c.substring)
+		sort.Strings(result)
+		expected := slices.Clone(c.expected)
+		sort.Strings(expected)
+		if !reflect.DeepEqual(result, expected) {
+			t.Errorf("FindUnverified(%q): expected %v, got %v", c.substring, expected, result)
+		}
+
+		// Every match found by Find must also be found without verification.
+		for _, str := range idx.Find(c.substring) {
+			if !slices.Contains(result, str) {
+				t.Errorf("FindUnverified(%q): missing match %q", c.substring, str)
+			}
+		}
+	}
 }
 
-func TestAddToIndex(t *testing.T) {
-	idx := &Index{
-		table:   make(map[uint32][]string),
-		strings: []string{},
+func TestLongestMatchingPrefix(t *testing.T) {
+	idx := NewIndex(smallCorpus())
+
+	cases := []struct {
+		substring string
+		prefix    string
+		expected  []string
+	}{
+		{"hello world", "hello world", []string{"hello world"}},
+		{"hello worlds", "hello world", []string{"hello world"}},
+		{"hello wonderful", "hello wo", []string{"hello world"}},
+		{"hello friend", "hello ", []string{"hello code", "hello there", "hello world"}},
+		{"general grievous", "general ", []string{"general kenobi"}},
+		{"!?", "", smallCorpus()},
+		{"", "", smallCorpus()},
+
+		// Prefixes are trimmed a whole character at a time.
+		{"testé", "test", []string{"test", "testing"}},
+	}
+	for _, limit := range []int{defaultBruteForceLimit, 0} {
+		idx.SetBruteForceLimit(limit)
+		for _, c := range cases {
+			prefix, result := idx.LongestMatchingPrefix(c.substring)
+			sort.Strings(result)
+			expected := slices.Clone(c.expected)
+			sort.Strings(expected)
+			if prefix != c.prefix || !reflect.DeepEqual(result, expected) {
+				t.Errorf("LongestMatchingPrefix(%q): expected %q %v, got %q %v",
+					c.substring, c.prefix, expected, prefix, result)
+			}
+		}
 	}
 
-	// Test adding a string for a new hash
-	hash1 := uint32(12345)
-	str1 := "test1"
-	idx.updateHash(hash1, str1)
+	prefix, result := NewIndex([]string{}).LongestMatchingPrefix("hello")
+	if prefix != "" || len(result) != 0 {
+		t.Errorf("Expected no prefix or matches for an empty index, got %q %v", prefix, result)
+	}
+}
 
-	if strings, exists := idx.table[hash1]; !exists || len(strings) != 1 || strings[0] != str1 {
-		t.Errorf("Expected new hash entry with string %s, got %v", str1, strings)
+func TestFindWithScores(t *testing.T) {
+	// Searches scan small indexes directly unless the brute force limit is
+	// lifted.
+	repeated := NewIndex([]string{"abcabc", "xabcabcx", "abcXabc", "abc"})
+	repeated.SetBruteForceLimit(0)
+	partial := NewIndex([]string{"abcd", "abcx", "xbcd", "bcde", "abcxbcd", "zzzz"})
+	partial.SetBruteForceLimit(0)
+	limited := NewIndexWithBucketLimit([]string{"the cat", "the hat", "the end"}, 2)
+	limited.SetBruteForceLimit(0)
+	small := NewIndex([]string{"abcd", "abcx", "xbcd"})
+
+	cases := []struct {
+		idx       *Index
+		substring string
+		expected  []ScoredMatch
+	}{
+		// Both examined n-grams are "abc", so each string containing it is
+		// hit twice, whether or not it contains the substring.
+		{repeated, "abcabc", []ScoredMatch{
+			{"abcabc", 2, true}, {"xabcabcx", 2, true}, {"abc", 2, false}, {"abcXabc", 2, false},
+		}},
+		{repeated, "abc", []ScoredMatch{
+			{"abc", 1, true}, {"abcXabc", 1, true}, {"abcabc", 1, true}, {"xabcabcx", 1, true},
+		}},
+		{repeated, "xyz", []ScoredMatch{}},
+
+		// Strings holding only some of the n-grams have fewer hits, and
+		// strings holding all of them may still fail verification.
+		{partial, "abcd", []ScoredMatch{
+			{"abcd", 2, true}, {"abcxbcd", 2, false}, {"abcx", 1, false}, {"bcde", 1, false}, {"xbcd", 1, false},
+		}},
+
+		// Short substrings have no n-grams.
+		{repeated, "ca", []ScoredMatch{{"abcabc", 0, true}, {"xabcabcx", 0, true}}},
+
+		// "the" is too common to be indexed, so it is never a hit.
+		{limited, "the cat", []ScoredMatch{{"the cat", 2, true}}},
+		{limited, "the", []ScoredMatch{{"the cat", 0, true}, {"the end", 0, true}, {"the hat", 0, true}}},
+
+		// Small indexes are scanned directly.
+		{small, "abcd", []ScoredMatch{{"abcd", 0, true}}},
+
+		// No string is long enough to contain the substring.
+		{partial, "abcdabcd", []ScoredMatch{}},
+	}
+	for _, c := range cases {
+		result := c.idx.FindWithScores(c.substring)
+		if !reflect.DeepEqual(result, c.expected) {
+			t.Errorf("FindWithScores(%q): expected %v, got %v", c.substring, c.expected, result)
+		}
+
+		var verified []string
+		for _, m := range result {
+			if m.Verified {
+				verified = append(verified, m.String)
+			}
+		}
+		found := c.idx.Find(c.substring)
+		sort.Strings(verified)
+		sort.Strings(found)
+		if len(verified) != 0 || len(found) != 0 {
+			if !reflect.DeepEqual(verified, found) {
+				t.Errorf("FindWithScores(%q): expected verified %v, got %v", c.substring, found, verified)
+			}
+		}
 	}
+}
 
-	// Test adding a different string with the same hash
-	str2 := "test2"
-	idx.updateHash(hash1, str2)
+// ngramGroups maps each distinct n-gram of an index's strings to the first
+// n-gram, in sorted order, whose hash is congruent to its own modulo m.
+func ngramGroups(idx *Index, m uint32) map[string]string {
+	var ngrams []string
+	for _, str := range idx.strings {
+		eachNgram(str, func(_ int, ngram string) {
+			ngrams = append(ngrams, ngram)
+		})
+	}
+	sort.Strings(ngrams)
 
-	if strings, exists := idx.table[hash1]; !exists || len(strings) != 2 ||
-		strings[0] != str1 || strings[1] != str2 {
-		t.Errorf("Expected hash entry with strings %s and %s, got %v", str1, str2, strings)
+	first := make(map[uint32]string)
+	groups := make(map[string]string)
+	for _, ngram := range ngrams {
+		r := idx.hash(ngram) % m
+		if _, ok := first[r]; !ok {
+			first[r] = ngram
+		}
+		groups[ngram] = first[r]
 	}
+	return groups
+}
 
-	// Test adding a duplicate string with the same hash (should not add duplicate)
-	idx.updateHash(hash1, str1)
+func TestNewIndexSeeded(t *testing.T) {
+	def := NewIndex(smallCorpus())
+	if same := NewIndexSeeded(smallCorpus(), prime0); !reflect.DeepEqual(same.table, def.table) {
+		t.Error("Expected the default seed to build the same index as NewIndex")
+	}
 
-	if strings, exists := idx.table[hash1]; !exists || len(strings) != 2 {
-		t.Errorf("Expected hash entry to still have 2 strings, got %v", strings)
+	a := NewIndexSeeded(smallCorpus(), 1)
+	b := NewIndexSeeded(smallCorpus(), 2)
+	if a.hash("ell") == b.hash("ell") || a.hash("ell") == def.hash("ell") {
+		t.Error("Expected different seeds to hash an n-gram differently")
+	}
+	if expected := []string{"hello world", "hello there", "hello code"}; !reflect.DeepEqual(a.Bucket("ell"), expected) {
+		t.Errorf("Expected bucket %v, got %v", expected, a.Bucket("ell"))
+	}
+
+	// Offsetting every hash by a constant would group n-grams identically
+	// modulo a power of two, so different seeds must group them differently.
+	if reflect.DeepEqual(ngramGroups(a, 64), ngramGroups(def, 64)) ||
+		reflect.DeepEqual(ngramGroups(a, 64), ngramGroups(b, 64)) {
+		t.Error("Expected different seeds to group n-grams into hashes differently")
+	}
+
+	// Rolling hashes must agree with direct hashes for every seed.
+	for _, seed := range []uint32{0, 1, prime0, 0xdeadbeef} {
+		idx := NewIndexSeeded(nil, seed)
+		str := "the quick brown fox"
+		h := idx.hash(str[:n])
+		for k := 1; k+n <= len(str); k++ {
+			h = idx.roll(h, str[k-1], str[k+n-1])
+			if expected := idx.hash(str[k : k+n]); h != expected {
+				t.Fatalf("Seed %d: rolled hash of %q is %d, expected %d", seed, str[k:k+n], h, expected)
+			}
+		}
+	}
+
+	for _, idx := range []*Index{a, b} {
+		for _, limit := range []int{defaultBruteForceLimit, 0} {
+			idx.SetBruteForceLimit(limit)
+			def.SetBruteForceLimit(limit)
+			name := fmt.Sprintf("Seed %d", idx.hasher.seed)
+			checkSameResults(t, name, idx, def)
+
+			// Compiled queries use the default seed, so they must be
+			// rehashed for seeded indexes.
+			compiled := findFunc(func(substr string) []string {
+				return idx.FindQuery(CompileQuery(substr))
+			})
+			checkSameResults(t, name+" compiled", compiled, def)
+		}
 	}
 }
 
-func TestFind(t *testing.T) {
+func TestCollisionReport(t *testing.T) {
+	idx := NewIndex([]string{"abcd", "acb", "dcba", "abc"})
+
+	// Summing an n-gram's bytes makes every permutation of an n-gram
+	// collide: "abc", "acb" and "cba" share a hash, as do "bcd" and "dcb".
+	sum := func(ngram string) uint32 {
+		var h uint32
+		for k := 0; k < len(ngram); k++ {
+			h += uint32(ngram[k])
+		}
+		return h
+	}
+	stats := idx.collisionReport(sum)
+	expected := CollisionStats{Ngrams: 5, Hashes: 2, Collisions: 2, MaxNgramsPerHash: 3}
+	if stats != expected {
+		t.Errorf("Expected %+v, got %+v", expected, stats)
+	}
+	if rate := stats.Rate(); rate != 1 {
+		t.Errorf("Expected collision rate 1, got %v", rate)
+	}
+
+	// The real hash doesn't collide on 3-byte n-grams.
+	stats = NewIndex(smallCorpus()).CollisionReport()
+	if stats.Collisions != 0 || stats.Hashes != stats.Ngrams || stats.MaxNgramsPerHash != 1 {
+		t.Errorf("Expected no collisions, got %+v", stats)
+	}
+	if rate := stats.Rate(); rate != 0 {
+		t.Errorf("Expected collision rate 0, got %v", rate)
+	}
+	if stats := NewIndex([]string{}).CollisionReport(); stats != (CollisionStats{}) {
+		t.Errorf("Expected empty report, got %+v", stats)
+	}
+}
+
+func TestFindRepetitive(t *testing.T) {
+	idx := NewIndex([]string{"aaaaaaaa", "aaaa", "baaaaaab", "aaabaaa", "ab"})
+	idx.SetBruteForceLimit(0)
+
+	cases := map[string][]string{
+		"aaa":       {"aaaa", "aaaaaaaa", "aaabaaa", "baaaaaab"},
+		"aaaaaa":    {"aaaaaaaa", "baaaaaab"},
+		"aaaaaaa":   {"aaaaaaaa"},
+		"aaaaaaaaa": {},
+		"aaabaaa":   {"aaabaaa"},
+	}
+	for substr, expected := range cases {
+		result := idx.Find(substr)
+		sort.Strings(result)
+		if !reflect.DeepEqual(result, expected) {
+			t.Errorf("Find(%q): expected %v, got %v", substr, expected, result)
+		}
+	}
+
+	// Repeated n-grams leave the candidates unchanged, so only the first
+	// one is used to narrow them down.
+	e := idx.Explain("aaaaaaa")
+	if len(e.Steps) != 3 {
+		t.Fatalf("Expected 3 steps, got %v", e.Steps)
+	}
+	for k, step := range e.Steps {
+		if step.Ngram != "aaa" || step.BucketSize != 4 || step.Candidates != 4 || step.Repeated != (k > 0) {
+			t.Errorf("Unexpected step %d: %+v", k, step)
+		}
+	}
+	if e := idx.Explain("aaabaaa"); e.Steps[0].Repeated || e.Steps[1].Repeated || e.Steps[2].Repeated {
+		t.Errorf("Expected no repeated steps for distinct n-grams, got %+v", e.Steps)
+	}
+
+	// Skipping the repeated intersections must not change the results, and
+	// must look up fewer strings than intersecting every n-gram's bucket.
+	for substr := range cases {
+		expected, baseline := findIntersectAll(idx, substr)
+		result := idx.Find(substr)
+		sort.Strings(result)
+		sort.Strings(expected)
+		if !reflect.DeepEqual(result, expected) {
+			t.Errorf("Find(%q): expected %v, got %v", substr, expected, result)
+		}
+
+		// Only substrings with more than one "aaa" n-gram repeat a hash.
+		lookups := explainLookups(idx.Explain(substr))
+		repetitive := len(substr) > n && strings.Count(substr, "a") == len(substr)
+		if !repetitive && lookups != baseline {
+			t.Errorf("Find(%q): expected the baseline's %d lookups, got %d", substr, baseline, lookups)
+		}
+		if repetitive && lookups >= baseline {
+			t.Errorf("Find(%q): expected fewer lookups than the baseline's %d, got %d", substr, baseline, lookups)
+		}
+	}
+}
+
+// findIntersectAll searches the index like Find, but intersects the
+// candidates with the bucket of every examined n-gram, even when its hash
+// repeats the previous one. It is the baseline for skipping repeated
+// hashes. It returns the matches along with the number of strings looked up
+// in the candidate sets. The index must have no hashes marked too common.
+func findIntersectAll(i *Index, substr string) ([]string, int) {
+	ngrams := Ngrams(substr)
+	candidates := make(map[string]bool)
+	tmp := make(map[string]bool)
+	lookups := 0
+	first := true
+	for off := 0; off >= 0; off = i.strategy.next(off, len(substr)) {
+		matches := i.getMatches(i.hash(ngrams[off]))
+		lookups += len(matches)
+		if first {
+			for _, str := range matches {
+				candidates[str] = true
+			}
+			first = false
+		} else {
+			for _, str := range matches {
+				if candidates[str] {
+					tmp[str] = true
+				}
+			}
+			candidates, tmp = tmp, candidates
+			clear(tmp)
+		}
+		if len(candidates) == 0 {
+			return []string{}, lookups
+		}
+	}
+
+	result := make([]string, 0, len(candidates))
+	for str := range candidates {
+		if contains(str, substr) {
+			result = append(result, str)
+		}
+	}
+	return result, lookups
+}
+
+// explainLookups returns the number of strings Find looked up in its
+// candidate sets according to an explanation.
+func explainLookups(e FindExplanation) int {
+	lookups := 0
+	for _, step := range e.Steps {
+		if !step.Skipped && !step.Repeated {
+			lookups += step.BucketSize
+		}
+	}
+	return lookups
+}
+
+func TestExplain(t *testing.T) {
+	idx := NewIndex([]string{"abcde", "defg", "xabcdef", "abcxyz"})
+	idx.SetBruteForceLimit(0)
+
+	step := func(ngram string, bucketSize, candidates int) ExplainStep {
+		return ExplainStep{
+			Ngram:      ngram,
+			Hash:       hash(ngram),
+			BucketSize: bucketSize,
+			Candidates: candidates,
+		}
+	}
+
 	cases := []struct {
-		name      string
-		strings   []string
 		substring string
-		expected  []string
+		expected  FindExplanation
 	}{
-		{
-			name:      "No matches (short)",
-			strings:   []string{"hello", "world", "hi there"},
-			substring: "x",
-			expected:  []string{},
-		},
-		{
-			name:      "No matches",
-			strings:   []string{"hello", "world", "hi there"},
-			substring: "xyzxyzxyz",
-			expected:  []string{},
-		},
-		{
-			name:      "Empty index",
-			strings:   []string{},
-			substring: "test",
-			expected:  []string{},
-		},
-		{
-			name:      "Substring shorter than n-gram size",
-			strings:   []string{"hello", "world", "hi there"},
-			substring: "hi",
-			expected:  []string{"hi there"},
-		},
-		{
-			name:      "All matches",
-			strings:   []string{"hello", "world", "hi there"},
-			substring: "",
-			expected:  []string{"hello", "world", "hi there"},
-		},
-		{
-			name:      "Multiple matches",
-			strings:   []string{"hello world", "world of code", "hello code"},
-			substring: "world",
-			expected:  []string{"hello world", "world of code"},
-		},
-		{
-			name:      "Substring exactly n-gram size",
-			strings:   []string{"abcdef", "xyzabc", "abcxyz"},
-			substring: string(make([]byte, n)),
-			expected:  []string{},
-		},
-		{
-			name:      "Substring longer than n-gram size",
-			strings:   []string{"hello world", "world hello", "hello there world"},
-			substring: "hello world",
-			expected:  []string{"hello world"},
-		},
-		{
-			name:      "Partial word match",
-			strings:   []string{"testing", "est", "test"},
-			substring: "tes",
-			expected:  []string{"testing", "test"},
-		},
-		{
-			name:      "Partial word match",
-			strings:   []string{"testing", "est", "test"},
-			substring: "est",
-			expected:  []string{"testing", "est", "test"},
-		},
-		{
-			name:      "Partial word match",
-			strings:   []string{"testing", "est", "test"},
-			substring: "sti",
-			expected:  []string{"testing"},
-		},
-		{
-			name:      "Partial word match",
-			strings:   []string{"testing", "est", "test"},
-			substring: "tin",
-			expected:  []string{"testing"},
-		},
-		{
-			name:      "Partial word match",
-			strings:   []string{"testing", "est", "test"},
-			substring: "ing",
-			expected:  []string{"testing"},
-		},
-		{
-			name:      "Multiple n-gram matches that fail",
-			strings:   []string{"abcde", "defg"},
-			substring: "abcdef",
-			expected:  []string{},
-		},
-		{
-			name:      "Case sensitivity",
-			strings:   []string{"Hello", "HELLO", "hello"},
-			substring: "hello",
-			expected:  []string{"hello"},
-		},
-		{
-			name:      "Noncontiguous n-grams",
-			strings:   []string{"abcXdefXghi", "XabcXdefX", "defabc"},
-			substring: "abcdef",
-			expected:  []string{},
-		},
-		{
-			name:      "Noncontiguous n-grams",
-			strings:   []string{"xabcdef"},
-			substring: "defxabc",
-			expected:  []string{},
-		},
+		{"ab", FindExplanation{BruteForce: true}},
+		{"abcdef", FindExplanation{Steps: []ExplainStep{
+			step("abc", 3, 3),
+			step("def", 2, 1),
+		}}},
+		{"abcde", FindExplanation{Steps: []ExplainStep{
+			step("abc", 3, 3),
+			step("cde", 2, 2),
+		}}},
+		{"abcdefg", FindExplanation{Steps: []ExplainStep{
+			step("abc", 3, 3),
+			step("def", 2, 1),
+			step("efg", 1, 0),
+		}}},
+		{"xyzabc", FindExplanation{Steps: []ExplainStep{
+			step("xyz", 1, 1),
+			step("abc", 3, 1),
+		}}},
+		{"qqqabc", FindExplanation{Steps: []ExplainStep{
+			step("qqq", 0, 0),
+		}}},
+
+		// No string is long enough to contain the substring, so Find doesn't
+		// examine any n-grams.
+		{"abcdefgh", FindExplanation{TooLong: true}},
 	}
 
 	for _, c := range cases {
-		t.Run(c.name, func(t *testing.T) {
-			idx := NewIndex(c.strings)
-			result := idx.Find(c.substring)
+		result := idx.Explain(c.substring)
+		if !reflect.DeepEqual(result, c.expected) {
+			t.Errorf("Explain(%q): expected %+v, got %+v", c.substring, c.expected, result)
+		}
+	}
+}
 
-			// Sort both slices for consistent comparison
-			sort.Strings(result)
-			sort.Strings(c.expected)
+func TestBucketLimit(t *testing.T) {
+	// Every string shares the n-gram "the", making its bucket hot.
+	testStrings := []string{
+		"the cat sat", "the dog ran", "on the mat", "bathe", "other",
+		"the end", "a cat", "catalog",
+	}
+	idx := NewIndexWithBucketLimit(testStrings, 4)
+	idx.SetBruteForceLimit(0)
+	unlimited := NewIndex(testStrings)
 
-			if !reflect.DeepEqual(result, c.expected) {
-				t.Errorf("Expected %v, got %v", c.expected, result)
-			}
-		})
+	hot := hash("the")
+	if !idx.common[hot] {
+		t.Errorf("Expected hash of %q to be marked too common", "the")
+	}
+	if _, ok := idx.table[hot]; ok {
+		t.Errorf("Expected bucket of %q to be discarded", "the")
+	}
+	if len(unlimited.common) != 0 {
+		t.Errorf("Expected no common hashes without a limit, got %d", len(unlimited.common))
+	}
+
+	e := idx.Explain("the cat")
+	if len(e.Steps) != 3 || !e.Steps[0].Skipped || e.Steps[1].Skipped || e.Steps[2].Skipped {
+		t.Errorf("Expected only the first n-gram to be skipped, got %+v", e.Steps)
+	}
+
+	for _, substr := range []string{"the", "the cat", "the end", "other", "cat", "at", "xyz", "the xyz"} {
+		result := idx.Find(substr)
+		expected := unlimited.Find(substr)
+		sort.Strings(result)
+		sort.Strings(expected)
+		if !reflect.DeepEqual(result, expected) {
+			t.Errorf("Find(%q): expected %v, got %v", substr, expected, result)
+		}
+	}
+}
+
+func TestGramStrategy(t *testing.T) {
+	overlap := NewIndex(smallCorpus())
+	overlap.SetBruteForceLimit(0)
+	skip := NewIndex(smallCorpus())
+	skip.SetBruteForceLimit(0)
+	skip.SetGramStrategy(SkipTail)
+
+	ngrams := func(e FindExplanation) []string {
+		grams := []string{}
+		for _, step := range e.Steps {
+			grams = append(grams, step.Ngram)
+		}
+		return grams
+	}
+	if got := ngrams(overlap.Explain("abcdefg")); !reflect.DeepEqual(got, []string{"abc", "def", "efg"}) {
+		t.Errorf("OverlapTail: unexpected n-grams %v", got)
+	}
+	if got := ngrams(skip.Explain("abcdefg")); !reflect.DeepEqual(got, []string{"abc", "def"}) {
+		t.Errorf("SkipTail: unexpected n-grams %v", got)
+	}
+
+	substrs := []string{
+		"", "x", "he", "hel", "hello", "world", "abcdef", "abcdefg", "defxabc",
+		"dolor", "xyzxyz", "hello there", "lorem ipsum dolor",
+	}
+	for _, substr := range substrs {
+		result := skip.Find(substr)
+		expected := overlap.Find(substr)
+		sort.Strings(result)
+		sort.Strings(expected)
+		if !reflect.DeepEqual(result, expected) {
+			t.Errorf("Find(%q): expected %v, got %v", substr, expected, result)
+		}
 	}
 }
 
@@ -221,6 +1458,31 @@ func TestGetStringsByHash(t *testing.T) {
 	}
 }
 
+func TestBucket(t *testing.T) {
+	idx := NewIndex([]string{"hello", "yellow", "help", "cello", "bell"})
+
+	result := idx.Bucket("ell")
+	expected := []string{"hello", "yellow", "cello", "bell"}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Bucket(%q): expected %v, got %v", "ell", expected, result)
+	}
+
+	// Mutating the returned bucket should not affect the index.
+	result[0] = "corrupted"
+	if got := idx.Bucket("ell"); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Bucket(%q) was modified through a returned copy: %v", "ell", got)
+	}
+
+	if got := idx.Bucket("xyz"); got == nil || len(got) != 0 {
+		t.Errorf("Expected empty bucket for missing n-gram, got %#v", got)
+	}
+	for _, ngram := range []string{"", "el", "ello"} {
+		if got := idx.Bucket(ngram); got != nil {
+			t.Errorf("Bucket(%q): expected nil for invalid n-gram, got %v", ngram, got)
+		}
+	}
+}
+
 func TestContains(t *testing.T) {
 	testCases := []struct {
 		str      string
@@ -241,11 +1503,283 @@ func TestContains(t *testing.T) {
 		{"", "", true},       // Empty substring in empty string
 	}
 
-	for _, tc := range testCases {
-		result := contains(tc.str, tc.substr)
-		if result != tc.expected {
-			t.Errorf("contains(%q, %q): expected %v, got %v",
-				tc.str, tc.substr, tc.expected, result)
+	for _, tc := range testCases {
+		result := contains(tc.str, tc.substr)
+		if result != tc.expected {
+			t.Errorf("contains(%q, %q): expected %v, got %v",
+				tc.str, tc.substr, tc.expected, result)
+		}
+	}
+}
+
+func TestFirstIndex(t *testing.T) {
+	testCases := []struct {
+		str      string
+		substr   string
+		expected int
+	}{
+		{"hello world", "hello", 0},
+		{"hello world", "world", 6},
+		{"hello world", "ello w", 1},
+		{"hello world", "o w", 4},
+		{"hello world", "o", 4},
+		{"hello world", " ", 5},
+		{"hello world", "", 0},
+		{"hello world", "worlds", -1},
+		{"hello", "hello world", -1},
+		{"hello", "", 0},     // Empty substring is contained at offset 0
+		{"", "hello", -1},    // Non-empty substring not in empty string
+		{"", "", 0},          // Empty substring in empty string
+		{"aaaa", "aa", 0},    // First of several overlapping occurrences
+		{"abcabc", "cab", 2}, // Occurrence spanning a repetition
+	}
+
+	for _, tc := range testCases {
+		result := FirstIndex(tc.str, tc.substr)
+		if result != tc.expected {
+			t.Errorf("FirstIndex(%q, %q): expected %d, got %d",
+				tc.str, tc.substr, tc.expected, result)
+		}
+		if contains(tc.str, tc.substr) != (tc.expected >= 0) {
+			t.Errorf("contains(%q, %q) disagrees with FirstIndex", tc.str, tc.substr)
+		}
+	}
+}
+
+func TestContainsFold(t *testing.T) {
+	testCases := []struct {
+		str      string
+		substr   string
+		expected bool
+	}{
+		{"hello world", "hello", true},
+		{"Hello World", "hello world", true},
+		{"HELLO WORLD", "o w", true},
+		{"hello world", "WORLD", true},
+		{"hello world", "worlds", false},
+		{"hello", "HELLO WORLD", false},
+		{"hello", "", true},
+		{"", "hello", false},
+		{"", "", true},
+		{"[hello]", "{HELLO}", false}, // Only letters are folded
+		{"ÉCOLE", "école", false},     // Non-ASCII must match exactly
+		{"École", "ÉCOLE", true},
+	}
+
+	for _, tc := range testCases {
+		result := ContainsFold(tc.str, tc.substr)
+		if result != tc.expected {
+			t.Errorf("ContainsFold(%q, %q): expected %v, got %v",
+				tc.str, tc.substr, tc.expected, result)
+		}
+	}
+}
+
+func TestFindFold(t *testing.T) {
+	testStrings := []string{"Hello World", "hello world", "HELLO WORLD", "say hellO"}
+	overlap := NewIndex(testStrings)
+	overlap.SetBruteForceLimit(0)
+	skip := NewIndex(testStrings)
+	skip.SetBruteForceLimit(0)
+	skip.SetGramStrategy(SkipTail)
+	brute := NewIndex(testStrings)
+
+	cases := []struct {
+		idx       *Index
+		substring string
+		expected  []string
+	}{
+		// Documented limitation: strings must contain the examined n-grams
+		// in the query's case.
+		{overlap, "hello", []string{"hello world"}},
+		{overlap, "Hello world", []string{}},
+
+		// Characters not covered by an examined n-gram may differ in case.
+		{skip, "hello", []string{"hello world", "say hellO"}},
+
+		// Scanning every string finds all case-insensitive matches.
+		{overlap, "lo", []string{"HELLO WORLD", "Hello World", "hello world", "say hellO"}},
+		{brute, "Hello world", []string{"HELLO WORLD", "Hello World", "hello world"}},
+	}
+	for _, c := range cases {
+		result := c.idx.FindFold(c.substring)
+		sort.Strings(result)
+		sort.Strings(c.expected)
+		if !reflect.DeepEqual(result, c.expected) {
+			t.Errorf("FindFold(%q): expected %v, got %v", c.substring, c.expected, result)
+		}
+	}
+}
+
+func TestOccurrences(t *testing.T) {
+	testCases := []struct {
+		str      string
+		substr   string
+		expected int
+	}{
+		{"aaaa", "aa", 3},
+		{"aaa", "aa", 2},
+		{"hello world", "o", 2},
+		{"hello world", "world", 1},
+		{"hello world", "worlds", 0},
+		{"hello", "hello world", 0},
+		{"abc", "", 4}, // Empty substring occurs at every position
+		{"", "", 1},
+	}
+
+	for _, tc := range testCases {
+		result := occurrences(tc.str, tc.substr)
+		if result != tc.expected {
+			t.Errorf("occurrences(%q, %q): expected %d, got %d",
+				tc.str, tc.substr, tc.expected, result)
+		}
+	}
+}
+
+func TestFindChan(t *testing.T) {
+	for _, limit := range []int{defaultBruteForceLimit, 0} {
+		idx := NewIndex(smallCorpus())
+		idx.SetBruteForceLimit(limit)
+
+		for _, substr := range []string{"", "x", "he", "hello", "world", "abcdef", "xyzxyz"} {
+			result := []string{}
+			for str := range idx.FindChan(context.Background(), substr) {
+				result = append(result, str)
+			}
+			expected := idx.Find(substr)
+			sort.Strings(result)
+			sort.Strings(expected)
+			if !reflect.DeepEqual(result, expected) {
+				t.Errorf("FindChan(%q): expected %v, got %v", substr, expected, result)
+			}
+		}
+	}
+}
+
+func TestFindChanCancel(t *testing.T) {
+	idx := NewIndex(smallCorpus())
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := idx.FindChan(ctx, "e")
+
+	// Read a single match, then stop reading and cancel the search. The
+	// channel should be closed once the search goroutine exits.
+	<-ch
+	cancel()
+
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case _, ok := <-ch:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("Expected channel to close after cancellation")
+		}
+	}
+}
+
+func TestFindWord(t *testing.T) {
+	testStrings := []string{
+		"the cat sat", "a cat.", "category", "bobcat", "cat", "cat-like",
+		"concatenate", "cats", "tomcat cat", "猫cat", "cat2", "an ox", "box",
+	}
+
+	cases := []struct {
+		word     string
+		expected []string
+	}{
+		{"cat", []string{"the cat sat", "a cat.", "cat", "cat-like", "tomcat cat"}},
+		{"ox", []string{"an ox"}},
+		{"at", []string{}},
+		{"a", []string{"a cat."}},
+		{"cat sat", []string{"the cat sat"}},
+		{"", []string{}},
+	}
+
+	for _, limit := range []int{defaultBruteForceLimit, 0} {
+		idx := NewIndex(testStrings)
+		idx.SetBruteForceLimit(limit)
+		for _, c := range cases {
+			result := idx.FindWord(c.word)
+			sort.Strings(result)
+			sort.Strings(c.expected)
+			if !reflect.DeepEqual(result, c.expected) {
+				t.Errorf("FindWord(%q): expected %v, got %v", c.word, c.expected, result)
+			}
+		}
+	}
+}
+
+func TestFindNoSpan(t *testing.T) {
+	testStrings := []string{
+		"first line\n\nsecond line",
+		"line\n\nsecond",
+		"one paragraph with line second",
+		"alpha\nbeta",
+		"xaaay",
+	}
+
+	cases := []struct {
+		substring string
+		sep       string
+		expected  []string
+	}{
+		// The substring only appears straddling the separator.
+		{"line\n\nsecond", "\n\n", []string{}},
+		{"ine\n\nsec", "\n\n", []string{}},
+		{"line second", "\n\n", []string{"one paragraph with line second"}},
+		{"second", "\n\n", []string{"first line\n\nsecond line", "line\n\nsecond", "one paragraph with line second"}},
+		{"first", "\n\n", []string{"first line\n\nsecond line"}},
+
+		// Separators may overlap one another, and the substring may not
+		// overlap any of them.
+		{"ay", "aa", []string{}},
+		{"xa", "aa", []string{}},
+		{"x", "aa", []string{"xaaay"}},
+		{"y", "aa", []string{"xaaay"}},
+
+		// A separator that isn't present behaves like Find.
+		{"alpha\nbeta", "\n\n", []string{"alpha\nbeta"}},
+
+		// An empty separator behaves like Find.
+		{"line\n\nsecond", "", []string{"first line\n\nsecond line", "line\n\nsecond"}},
+	}
+
+	for _, limit := range []int{defaultBruteForceLimit, 0} {
+		idx := NewIndex(testStrings)
+		idx.SetBruteForceLimit(limit)
+		for _, c := range cases {
+			result := idx.FindNoSpan(c.substring, c.sep)
+			sort.Strings(result)
+			sort.Strings(c.expected)
+			if !reflect.DeepEqual(result, c.expected) {
+				t.Errorf("FindNoSpan(%q, %q): expected %q, got %q", c.substring, c.sep, c.expected, result)
+			}
+		}
+	}
+}
+
+func TestTotalOccurrences(t *testing.T) {
+	if got := NewIndex([]string{"aaaa"}).TotalOccurrences("aa"); got != 3 {
+		t.Errorf("Expected 3 occurrences of %q, got %d", "aa", got)
+	}
+
+	idx := NewIndex([]string{"banana", "bandana", "cabana", "apple"})
+	cases := []struct {
+		substring string
+		expected  int
+	}{
+		{"ana", 4},
+		{"an", 5},
+		{"a", 10},
+		{"banana", 1},
+		{"xyz", 0},
+		{"nab", 0},
+	}
+	for _, c := range cases {
+		if got := idx.TotalOccurrences(c.substring); got != c.expected {
+			t.Errorf("TotalOccurrences(%q): expected %d, got %d", c.substring, c.expected, got)
 		}
 	}
 }
@@ -282,6 +1816,57 @@ func TestCalculateHash(t *testing.T) {
 	}
 }
 
+func TestNgrams(t *testing.T) {
+	testCases := []struct {
+		str      string
+		expected []string
+	}{
+		{"hello", []string{"hel", "ell", "llo"}},
+		{"abc", []string{"abc"}},
+		{"ab", []string{}},
+		{"", []string{}},
+	}
+	for _, tc := range testCases {
+		if result := Ngrams(tc.str); !reflect.DeepEqual(result, tc.expected) {
+			t.Errorf("Ngrams(%q): expected %v, got %v", tc.str, tc.expected, result)
+		}
+	}
+
+	// The index should store each string under exactly the hashes of its
+	// n-grams.
+	idx := NewIndex(smallCorpus())
+	for _, str := range idx.strings {
+		expected := map[uint32]bool{}
+		for _, ngram := range Ngrams(str) {
+			expected[hash(ngram)] = true
+		}
+		found := map[uint32]bool{}
+		for hash, bucket := range idx.table {
+			if slices.Contains(bucket, str) {
+				found[hash] = true
+			}
+		}
+		if !reflect.DeepEqual(found, expected) {
+			t.Errorf("Index stores %q under unexpected hashes", str)
+		}
+	}
+}
+
+func TestRollHash(t *testing.T) {
+	strs := []string{"abc", "abcdefg", "hello world", "こんにちは世界", makeString(50)}
+	for _, str := range strs {
+		h := hash(str[:n])
+		for k := n; k <= len(str); k++ {
+			if expected := hash(str[k-n : k]); h != expected {
+				t.Errorf("roll(%q) at %d: expected %d, got %d", str, k-n, expected, h)
+			}
+			if k < len(str) {
+				h = roll(h, str[k-n], str[k])
+			}
+		}
+	}
+}
+
 // TestEdgeCases tests various edge cases that might not be covered elsewhere
 func TestEdgeCases(t *testing.T) {
 	// Test with string containing only repeated characters
@@ -317,6 +1902,170 @@ func TestEdgeCases(t *testing.T) {
 	}
 }
 
+func TestRemoveFunc(t *testing.T) {
+	testStrings := []string{
+		"tenant1:hello world", "tenant2:hello there", "tenant1:world of code",
+		"tenant3:hello code", "tenant2:goodbye world", "tenant1:lorem ipsum dolor sit amet",
+	}
+
+	for _, limit := range []int{defaultBruteForceLimit, 0} {
+		idx := NewCachedIndex(testStrings, 10)
+		idx.SetBruteForceLimit(limit)
+		idx.Find("world")
+
+		removed := idx.RemoveFunc(func(s string) bool {
+			return strings.HasPrefix(s, "tenant1:")
+		})
+		if removed != 3 {
+			t.Errorf("Expected 3 strings removed, got %d", removed)
+		}
+
+		expected := []string{"tenant2:hello there", "tenant3:hello code", "tenant2:goodbye world"}
+		if !reflect.DeepEqual(idx.strings, expected) {
+			t.Errorf("Expected remaining strings %v, got %v", expected, idx.strings)
+		}
+		if _, ok := idx.position["tenant1:hello world"]; ok {
+			t.Error("Expected removed string's position to be forgotten")
+		}
+		for hash, bucket := range idx.table {
+			for _, str := range bucket {
+				if strings.HasPrefix(str, "tenant1:") {
+					t.Errorf("Expected %q to be removed from bucket %d", str, hash)
+				}
+			}
+		}
+
+		cases := map[string][]string{
+			"world":   {"tenant2:goodbye world"},
+			"hello":   {"tenant2:hello there", "tenant3:hello code"},
+			"tenant1": {},
+			"lorem":   {},
+			"tenant":  {"tenant2:goodbye world", "tenant2:hello there", "tenant3:hello code"},
+		}
+		for substr, expected := range cases {
+			result := idx.Find(substr)
+			sort.Strings(result)
+			if !reflect.DeepEqual(result, expected) {
+				t.Errorf("Find(%q): expected %v, got %v", substr, expected, result)
+			}
+		}
+
+		if removed := idx.RemoveFunc(func(string) bool { return false }); removed != 0 {
+			t.Errorf("Expected no strings removed, got %d", removed)
+		}
+	}
+}
+
+func TestCompact(t *testing.T) {
+	testStrings := []string{
+		"hello world", "goodbye world", "hello there", "general kenobi",
+		"lorem ipsum dolor sit amet", "world of code", "hello code",
+	}
+	idx := NewIndex(slices.Clone(testStrings))
+
+	// Simulate bulk removals by dropping all but the first two strings from
+	// the strings list and every bucket, leaving spare capacity and empty
+	// buckets behind.
+	keep := testStrings[:2]
+	idx.strings = idx.strings[:len(keep)]
+	for hash, bucket := range idx.table {
+		idx.table[hash] = slices.DeleteFunc(bucket, func(s string) bool {
+			return !slices.Contains(keep, s)
+		})
+	}
+
+	idx.Compact()
+
+	if cap(idx.strings) != len(idx.strings) {
+		t.Errorf("Expected strings capacity %d, got %d", len(idx.strings), cap(idx.strings))
+	}
+	if len(idx.position) != len(idx.strings) {
+		t.Errorf("Expected %d string positions, got %d", len(idx.strings), len(idx.position))
+	}
+	for hash, bucket := range idx.table {
+		if len(bucket) == 0 {
+			t.Errorf("Expected empty bucket %d to be deleted", hash)
+		}
+		if cap(bucket) != len(bucket) {
+			t.Errorf("Expected bucket %d capacity %d, got %d", hash, len(bucket), cap(bucket))
+		}
+	}
+
+	cases := []struct {
+		substring string
+		expected  []string
+	}{
+		{"world", []string{"hello world", "goodbye world"}},
+		{"hello", []string{"hello world"}},
+		{"code", []string{}},
+		{"", keep},
+	}
+	for _, c := range cases {
+		result := idx.Find(c.substring)
+		sort.Strings(result)
+		expected := slices.Clone(c.expected)
+		sort.Strings(expected)
+		if !reflect.DeepEqual(result, expected) {
+			t.Errorf("Find(%q): expected %v, got %v", c.substring, expected, result)
+		}
+	}
+}
+
+func TestAll(t *testing.T) {
+	input := smallCorpus()
+	idx := NewIndex(input)
+
+	result := []string{}
+	for k, str := range idx.All() {
+		if k != len(result) {
+			t.Errorf("Expected position %d, got %d", len(result), k)
+		}
+		result = append(result, str)
+	}
+	if !reflect.DeepEqual(result, input) {
+		t.Errorf("Expected %v, got %v", input, result)
+	}
+
+	// Stopping early should end the iteration.
+	count := 0
+	for range idx.All() {
+		count++
+		if count == 3 {
+			break
+		}
+	}
+	if count != 3 {
+		t.Errorf("Expected iteration to stop after 3 strings, got %d", count)
+	}
+}
+
+func TestClone(t *testing.T) {
+	idx := NewIndex([]string{"hello world", "world of code", "hello code"})
+	clone := idx.Clone()
+
+	// Mutate the original the same way a build does, appending to both the
+	// strings list and existing buckets.
+	added := "brave new world"
+	idx.strings = append(idx.strings, added)
+	for s := added; len(s) >= n; s = s[1:] {
+		appendHashUnique(idx, hash(s[:n]), added)
+	}
+
+	if got := idx.Find("world"); len(got) != 3 {
+		t.Errorf("Expected original to find 3 matches, got %v", got)
+	}
+
+	result := clone.Find("world")
+	sort.Strings(result)
+	expected := []string{"hello world", "world of code"}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected clone to find %v, got %v", expected, result)
+	}
+	if got := clone.Find(""); len(got) != 3 {
+		t.Errorf("Expected clone to hold 3 strings, got %v", got)
+	}
+}
+
 // Benchmark the index building
 func BenchmarkNewIndex(b *testing.B) {
 	testStrings := []string{
@@ -333,6 +2082,197 @@ func BenchmarkNewIndex(b *testing.B) {
 	}
 }
 
+// appendHashUnique is a test-only reference for appendHash. It adds a
+// string to the index under the given hash, unless the hash's bucket already
+// holds the string anywhere. Unlike appendHash, it checks the whole bucket,
+// so tests also use it to add strings to an index that has already been
+// built.
+func appendHashUnique(i *Index, hash uint32, str string) {
+	if !slices.Contains(i.table[hash], str) {
+		i.appendHash(hash, str)
+	}
+}
+
+// newIndexNoRoll builds an index by hashing every n-gram from scratch. It is
+// the baseline for comparing the rolling hash build.
+func newIndexNoRoll(strings []string) *Index {
+	i := &Index{
+		strings: strings,
+		table:   make(map[uint32][]string),
+	}
+	for _, str := range strings {
+		for s := str; len(s) >= n; s = s[1:] {
+			appendHashUnique(i, hash(s[:n]), str)
+		}
+	}
+	return i
+}
+
+func longStrings() []string {
+	const text = "the quick brown fox jumps over the lazy dog 0123456789 "
+	strs := make([]string, 16)
+	for i := range strs {
+		strs[i] = strings.Repeat(text[i:]+text[:i], 200)
+	}
+	return strs
+}
+
+// Benchmark the index building on long strings using the rolling hash
+func BenchmarkNewIndexLong(b *testing.B) {
+	testStrings := longStrings()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		NewIndex(testStrings)
+	}
+}
+
+// Benchmark the index building on long strings without the rolling hash
+func BenchmarkNewIndexLongNoRoll(b *testing.B) {
+	testStrings := longStrings()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		newIndexNoRoll(testStrings)
+	}
+}
+
+// Benchmark searches of a 20-string corpus using the index
+func BenchmarkFindSmallIndexed(b *testing.B) {
+	idx := NewIndex(smallCorpus())
+	idx.SetBruteForceLimit(0)
+	queries := []string{"world", "hello there", "abcdef", "dolor", "xyzxyz"}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, q := range queries {
+			idx.Find(q)
+		}
+	}
+}
+
+// Benchmark searches of a 20-string corpus using brute force
+func BenchmarkFindSmallBruteForce(b *testing.B) {
+	idx := NewIndex(smallCorpus())
+	idx.SetBruteForceLimit(len(smallCorpus()) + 1)
+	queries := []string{"world", "hello there", "abcdef", "dolor", "xyzxyz"}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, q := range queries {
+			idx.Find(q)
+		}
+	}
+}
+
+func benchmarkGramStrategy(b *testing.B, strategy GramStrategy) {
+	idx := NewIndex(longStrings())
+	idx.SetGramStrategy(strategy)
+	queries := []string{"quick brown", "lazy dog 01", "over the", "fox jumps", "xyzxy"}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, q := range queries {
+			idx.Find(q)
+		}
+	}
+}
+
+// Benchmark searches using the OverlapTail strategy
+func BenchmarkFindOverlapTail(b *testing.B) {
+	benchmarkGramStrategy(b, OverlapTail)
+}
+
+// Benchmark searches using the SkipTail strategy
+func BenchmarkFindSkipTail(b *testing.B) {
+	benchmarkGramStrategy(b, SkipTail)
+}
+
+// worstCaseStrings returns strings whose n-grams collide into a few hot
+// buckets, both within each string and across strings.
+func worstCaseStrings() []string {
+	strs := make([]string, 2000)
+	for i := range strs {
+		strs[i] = strings.Repeat("abc", 100) + strconv.Itoa(i)
+	}
+	return strs
+}
+
+// Benchmark the index building on strings sharing a few hot n-grams
+func BenchmarkNewIndexWorstCase(b *testing.B) {
+	testStrings := worstCaseStrings()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		NewIndex(testStrings)
+	}
+}
+
+// Benchmark building an index from duplicate-heavy input
+func BenchmarkNewIndexDuplicates(b *testing.B) {
+	testStrings := duplicateStrings()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		NewIndex(testStrings)
+	}
+}
+
+// Benchmark building an index from duplicate-heavy input without
+// deduplicating its strings
+func BenchmarkNewIndexDuplicatesNoIntern(b *testing.B) {
+	testStrings := duplicateStrings()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		newIndexNoIntern(testStrings)
+	}
+}
+
+// newIndexNoIntern builds an index the way NewIndex does, but indexes every
+// input string as given instead of only its first appearance.
+func newIndexNoIntern(strings []string) *Index {
+	i := newIndex(nil)
+	i.strings = strings
+	i.build()
+	return i
+}
+
+// largeCorpus returns many distinct strings with a wide variety of n-grams.
+func largeCorpus() []string {
+	words := strings.Fields("the quick brown fox jumps over lazy dog lorem ipsum dolor sit amet")
+	strs := make([]string, 20000)
+	for i := range strs {
+		strs[i] = words[i%len(words)] + " " + strconv.FormatInt(int64(i)*2654435761, 36)
+	}
+	return strs
+}
+
+// Benchmark building a large index without presizing its hash table
+func BenchmarkNewIndexLarge(b *testing.B) {
+	testStrings := largeCorpus()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		NewIndex(testStrings)
+	}
+}
+
+// Benchmark building a large index with a presized hash table
+func BenchmarkNewIndexSizedLarge(b *testing.B) {
+	testStrings := largeCorpus()
+	buckets := len(NewIndex(testStrings).table)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		NewIndexSized(testStrings, buckets)
+	}
+}
+
 // Benchmark the find operation
 func BenchmarkFind(b *testing.B) {
 	testStrings := []string{
@@ -350,3 +2290,124 @@ func BenchmarkFind(b *testing.B) {
 		idx.Find("world")
 	}
 }
+
+// Benchmark a query longer than every string in a large index
+func BenchmarkFindOverlong(b *testing.B) {
+	idx := NewIndex(largeCorpus())
+	query := "the quick brown fox jumps over the lazy dog"
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		idx.Find(query)
+	}
+}
+
+// Benchmark a query longer than every string in a large index, without
+// short-circuiting on the index's longest string
+func BenchmarkFindOverlongNoShortCircuit(b *testing.B) {
+	idx := NewIndex(largeCorpus())
+	idx.maxLen = math.MaxInt
+	query := "the quick brown fox jumps over the lazy dog"
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		idx.Find(query)
+	}
+}
+
+// Benchmark a query on long strings, verifying the candidates
+func BenchmarkFindVerified(b *testing.B) {
+	idx := NewIndex(longStrings())
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		idx.Find("lazy dog 0123")
+	}
+}
+
+// Benchmark a query on long strings, without verifying the candidates
+func BenchmarkFindUnverified(b *testing.B) {
+	idx := NewIndex(longStrings())
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		idx.FindUnverified("lazy dog 0123")
+	}
+}
+
+func repetitiveStrings() []string {
+	strs := make([]string, 1000)
+	for i := range strs {
+		strs[i] = strings.Repeat("a", 200+i%100) + strconv.Itoa(i)
+	}
+	return strs
+}
+
+// Benchmark a long repetitive query, whose n-grams all share a hash
+func BenchmarkFindRepetitive(b *testing.B) {
+	idx := NewIndex(repetitiveStrings())
+	query := strings.Repeat("a", 250)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		idx.Find(query)
+	}
+	b.ReportMetric(float64(explainLookups(idx.Explain(query))), "lookups/op")
+}
+
+// Benchmark a long repetitive query, intersecting the candidates with every
+// n-gram's bucket
+func BenchmarkFindRepetitiveIntersectAll(b *testing.B) {
+	idx := NewIndex(repetitiveStrings())
+	query := strings.Repeat("a", 250)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	var lookups int
+	for i := 0; i < b.N; i++ {
+		_, lookups = findIntersectAll(idx, query)
+	}
+	b.ReportMetric(float64(lookups), "lookups/op")
+}
+
+func batchQueries() []string {
+	words := []string{"world", "hello", "code", "lorem", "ipsum", "there", "kenobi", "dolor", "good", "amet"}
+	queries := make([]string, 0, 50)
+	for len(queries) < 50 {
+		for _, w := range words {
+			queries = append(queries, w[:3+len(queries)%(len(w)-2)])
+		}
+	}
+	return queries
+}
+
+// Benchmark 50 queries performed with FindBatch
+func BenchmarkFindBatch(b *testing.B) {
+	idx := NewIndex(longStrings())
+	queries := batchQueries()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		idx.FindBatch(queries)
+	}
+}
+
+// Benchmark 50 queries performed with separate Find calls
+func BenchmarkFindBatchSeparate(b *testing.B) {
+	idx := NewIndex(longStrings())
+	queries := batchQueries()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, q := range queries {
+			idx.Find(q)
+		}
+	}
+}
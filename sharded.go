@@ -0,0 +1,77 @@
+package rkindex
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// ShardedIndex is a search index whose strings are partitioned across
+// several independent indexes, or shards, each with a small hash table. A
+// search may query the shards concurrently, spreading its work across cores
+// that other searches leave idle.
+type ShardedIndex struct {
+	shards []*Index
+	active atomic.Int32 // number of searches in progress
+}
+
+// NewShardedIndex builds a sharded index from all provided strings, which are
+// partitioned across the given number of shards by their hashes. Duplicate
+// strings always land in the same shard, so they are indexed only once. A
+// shard count of less than one is treated as one.
+func NewShardedIndex(strings []string, shards int) *ShardedIndex {
+	shards = max(shards, 1)
+	parts := make([][]string, shards)
+	for _, str := range strings {
+		k := hash(str) % uint32(shards)
+		parts[k] = append(parts[k], str)
+	}
+
+	si := &ShardedIndex{shards: make([]*Index, shards)}
+	for k, part := range parts {
+		si.shards[k] = NewIndex(part)
+	}
+	return si
+}
+
+// Find searches every shard of the index and returns all substring matches.
+// Each shard narrows down and verifies its own candidates, so the results
+// are the same as those of a single index holding all the strings, though
+// their order may differ. The available cores, as reported by GOMAXPROCS,
+// are divided among the searches in progress, and a search runs its shards
+// in up to that many goroutines, including the calling one. When concurrent
+// callers already keep every core busy, the shards are searched one after
+// another in the calling goroutine.
+func (si *ShardedIndex) Find(substr string) []string {
+	active := int(si.active.Add(1))
+	defer si.active.Add(-1)
+	workers := min(len(si.shards), max(runtime.GOMAXPROCS(0)/active, 1))
+
+	results := make([][]string, len(si.shards))
+	var next atomic.Int32
+	work := func() {
+		for k := int(next.Add(1)) - 1; k < len(si.shards); k = int(next.Add(1)) - 1 {
+			results[k] = si.shards[k].Find(substr)
+		}
+	}
+	var wg sync.WaitGroup
+	for range workers - 1 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			work()
+		}()
+	}
+	work()
+	wg.Wait()
+
+	total := 0
+	for _, r := range results {
+		total += len(r)
+	}
+	result := make([]string, 0, total)
+	for _, r := range results {
+		result = append(result, r...)
+	}
+	return result
+}
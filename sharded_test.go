@@ -0,0 +1,90 @@
+package rkindex
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func TestShardedIndex(t *testing.T) {
+	testStrings := append(smallCorpus(), "hello world", "hello world")
+	idx := NewIndex(testStrings)
+
+	for _, shards := range []int{-1, 0, 1, 3, 8} {
+		si := NewShardedIndex(testStrings, shards)
+		if expected := max(shards, 1); len(si.shards) != expected {
+			t.Errorf("Expected %d shards, got %d", expected, len(si.shards))
+		}
+
+		// Every distinct string should be held by exactly one shard.
+		total := 0
+		for _, shard := range si.shards {
+			total += len(shard.strings)
+		}
+		if total != len(idx.strings) {
+			t.Errorf("%d shards: expected %d strings across shards, got %d", shards, len(idx.strings), total)
+		}
+
+		checkSameResults(t, fmt.Sprintf("%d shards", shards), si, idx)
+	}
+}
+
+func TestShardedIndexConcurrent(t *testing.T) {
+	// Allow searches to use several goroutines even on a single core.
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+
+	testStrings := smallCorpus()
+	idx := NewIndex(testStrings)
+	si := NewShardedIndex(testStrings, 8)
+	expected := idx.Find("hel")
+	sort.Strings(expected)
+
+	// However many searches are in progress, each must see every shard.
+	for _, callers := range []int{1, 2, 8} {
+		var wg sync.WaitGroup
+		for range callers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for range 50 {
+					result := si.Find("hel")
+					sort.Strings(result)
+					if !reflect.DeepEqual(result, expected) {
+						t.Errorf("%d callers: expected %v, got %v", callers, expected, result)
+						return
+					}
+				}
+			}()
+		}
+		wg.Wait()
+	}
+}
+
+// Benchmark concurrent queries against a single large index
+func BenchmarkFindParallel(b *testing.B) {
+	idx := NewIndex(largeCorpus())
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			idx.Find("fox 1")
+		}
+	})
+}
+
+// Benchmark concurrent queries against a large index split into 8 shards
+func BenchmarkFindParallelSharded(b *testing.B) {
+	si := NewShardedIndex(largeCorpus(), 8)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			si.Find("fox 1")
+		}
+	})
+}